@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	pb "gitlab.com/momentum-valley/advanced-search/rpc/advanced-search"
+)
+
+// find-capacity 的 SLO：sloQuantile 分位的延时不超过 -l，错误率低于 sloErrors
+var sloQuantile = flag.Float64("slo-quantile", 99, "latency quantile of find-capacity SLO, the limit is -l")
+var sloErrors = flag.Float64("slo-errors", 1, "max error ratio(%) of find-capacity SLO")
+var trialSeconds = flag.Int("trial", 10, "seconds of each find-capacity trial")
+var cooldown = flag.Duration("cooldown", 5*time.Second, "pause between find-capacity trials")
+var resolution = flag.Int("resolution", 5, "find-capacity stops when the qps range is narrower than this")
+var maxQPS = flag.Int("max-qps", 2000, "upper bound of find-capacity")
+var confirmTrials = flag.Int("confirm", 3, "trials to confirm the found qps")
+
+type trialResult struct {
+	qps        int
+	latency    float64
+	errorRatio float64
+	pass       bool
+}
+
+// findCapacity 从 -q 开始跑短时间的压测，满足 SLO 就加大步长往上探，
+// 不满足后在最后一次满足和第一次不满足之间二分，最后在找到的 qps 上重复验证
+func findCapacity(ctx context.Context) {
+	if *concurrency > 0 {
+		log.Printf("find-capacity only works in qps mode")
+		return
+	}
+	client := pb.NewAdvancedSearchProtobufClient(searchURL, &http.Client{})
+	w, err := loadSearchWorkload()
+	if err != nil {
+		return
+	}
+	log.Printf("SLO: p%g <= %d ms, errors < %.2f%%", *sloQuantile, *timeLimit, *sloErrors)
+
+	trial := func(qps int) trialResult {
+		stats := runLoad(ctx, client, w, constantPhases(qps, *trialSeconds))
+		res := trialResult{
+			qps:        qps,
+			latency:    stats.all.quantile(*sloQuantile),
+			errorRatio: stats.all.errorRatio(),
+		}
+		res.pass = stats.all.total > 0 && res.latency*1000 <= float64(*timeLimit) && res.errorRatio < *sloErrors
+		log.Printf("trial qps=%d p%g=%.5fs errors=%.2f%% pass=%t", qps, *sloQuantile, res.latency, res.errorRatio, res.pass)
+		// 等服务端把积压的请求处理完
+		sleepUntil(ctx, time.Now().Add(*cooldown))
+		return res
+	}
+	// passes 第二个返回值为 false 表示被中断
+	passes := func(qps int) (bool, bool) {
+		pass := trial(qps).pass
+		if ctx.Err() != nil {
+			log.Printf("find-capacity interrupted")
+			return false, false
+		}
+		return pass, true
+	}
+
+	lo, hi, ok := searchCapacity(*qps, *maxQPS, *resolution, passes)
+	if !ok {
+		return
+	}
+	if hi == 0 {
+		log.Printf("SLO still holds at max-qps=%d", *maxQPS)
+	}
+	if lo == 0 {
+		log.Printf("SLO does not hold even at qps=%d", hi)
+		return
+	}
+
+	passed := 0
+	for i := 0; i < *confirmTrials; i++ {
+		pass, ok := passes(lo)
+		if !ok {
+			return
+		}
+		if pass {
+			passed++
+		}
+	}
+	confidence := 100.0
+	if *confirmTrials > 0 {
+		confidence = float64(passed) / float64(*confirmTrials) * 100
+	}
+	if hi == 0 {
+		log.Printf("max sustainable qps>=%d (max-qps), confirmed %d/%d trials, confidence=%.0f%%",
+			lo, passed, *confirmTrials, confidence)
+		return
+	}
+	log.Printf("max sustainable qps=%d (fails at %d), confirmed %d/%d trials, confidence=%.0f%%",
+		lo, hi, passed, *confirmTrials, confidence)
+}
+
+// searchCapacity 从 start 开始按加倍的步长往上探，直到不满足 SLO 或者到 maxQPS，
+// 然后在 lo 和 hi 之间二分到 resolution 以内
+// lo: 最高的满足 SLO 的 qps，为 0 表示 hi 都不满足；hi: 最低的不满足 SLO 的 qps，为 0 表示 maxQPS 也满足
+// passes 返回是否满足 SLO，第二个返回值为 false 表示被中断
+func searchCapacity(start int, maxQPS int, resolution int, passes func(qps int) (bool, bool)) (lo int, hi int, ok bool) {
+	step := start / 2
+	if step < resolution {
+		step = resolution
+	}
+	for q := start; q <= maxQPS; q += step {
+		passed, ok := passes(q)
+		if !ok {
+			return lo, hi, false
+		}
+		if !passed {
+			hi = q
+			break
+		}
+		lo = q
+		step *= 2
+	}
+	if hi == 0 && lo < maxQPS {
+		// 步长跳过了 maxQPS，在 maxQPS 上也跑一次
+		passed, ok := passes(maxQPS)
+		if !ok {
+			return lo, hi, false
+		}
+		if passed {
+			return maxQPS, 0, true
+		}
+		hi = maxQPS
+	}
+	// hi 为 0 时没有不满足 SLO 的 qps，不用二分
+	for hi > 0 && hi-lo > resolution {
+		mid := (lo + hi) / 2
+		passed, ok := passes(mid)
+		if !ok {
+			return lo, hi, false
+		}
+		if passed {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo, hi, true
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSearchCapacity(t *testing.T) {
+	tests := []struct {
+		name     string
+		start    int
+		maxQPS   int
+		capacity int
+		trials   []int
+	}{
+		{name: "bisect", start: 50, maxQPS: 2000, capacity: 180},
+		// 50, 100, ..., 1600 都满足，步长跳过了 max-qps，max-qps 也要跑一次
+		{name: "holds at max", start: 50, maxQPS: 2000, capacity: 5000, trials: []int{50, 100, 200, 400, 800, 1600, 2000}},
+		{name: "fails at max", start: 50, maxQPS: 2000, capacity: 1900},
+		{name: "fails at start", start: 50, maxQPS: 2000, capacity: 10},
+		{name: "start above max", start: 3000, maxQPS: 2000, capacity: 5000, trials: []int{2000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trials := make([]int, 0)
+			lo, hi, ok := searchCapacity(tt.start, tt.maxQPS, 5, func(qps int) (bool, bool) {
+				trials = append(trials, qps)
+				return qps <= tt.capacity, true
+			})
+			if !ok {
+				t.Fatalf("searchCapacity() interrupted")
+			}
+			if tt.capacity >= tt.maxQPS {
+				if lo != tt.maxQPS || hi != 0 {
+					t.Errorf("searchCapacity() = %d, %d, want %d, 0", lo, hi, tt.maxQPS)
+				}
+			} else if lo > tt.capacity || hi <= tt.capacity || hi-lo > 5 {
+				t.Errorf("searchCapacity() = %d, %d, want a range of 5 around %d (trials %v)", lo, hi, tt.capacity, trials)
+			}
+			if tt.trials != nil && fmt.Sprint(trials) != fmt.Sprint(tt.trials) {
+				t.Errorf("trials = %v, want %v", trials, tt.trials)
+			}
+		})
+	}
+}
+
+func TestSearchCapacityInterrupted(t *testing.T) {
+	calls := 0
+	_, _, ok := searchCapacity(50, 2000, 5, func(qps int) (bool, bool) {
+		calls++
+		return true, calls < 3
+	})
+	if ok || calls != 3 {
+		t.Errorf("searchCapacity() ok = %t after %d trials, want false after 3", ok, calls)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	pb "gitlab.com/momentum-valley/advanced-search/rpc/advanced-search"
+)
+
+var slowFile = flag.String("slow", "slow_requests.jsonl", "write requests slower than -l to this jsonl file, empty means discard")
+
+// slowRequests 为 nil 时不记录
+var slowRequests *requestLogger
+
+// requestRecord 一行 jsonl，request 是 protobuf 的 json 格式
+type requestRecord struct {
+	Time        time.Time       `json:"time"`
+	Latency     float64         `json:"latency"`
+	Outcome     string          `json:"outcome,omitempty"`
+	Count       int             `json:"count"`
+	Error       string          `json:"error,omitempty"`
+	Fingerprint string          `json:"fingerprint"`
+	Request     json.RawMessage `json:"request"`
+	// Status record 时 upstream 返回的 http 状态码，-slow 没有
+	Status int `json:"status,omitempty"`
+}
+
+func newRequestRecord(req *pb.SearchRequest, sendTime time.Time, res testResult) (*requestRecord, error) {
+	var buf bytes.Buffer
+	if err := (&jsonpb.Marshaler{}).Marshal(&buf, req); err != nil {
+		return nil, err
+	}
+	record := &requestRecord{
+		Time:        sendTime,
+		Latency:     res.Cost.Seconds(),
+		Outcome:     res.outcome(),
+		Count:       res.Count,
+		Fingerprint: fingerprint(req),
+		Request:     buf.Bytes(),
+	}
+	if res.Err != nil {
+		record.Error = res.Err.Error()
+	}
+	return record, nil
+}
+
+// fingerprint 只看查询的结构（搜索类型、条件的字段和操作符、排序），不看条件的值，
+// 结构相同的请求 fingerprint 相同
+func fingerprint(req *pb.SearchRequest) string {
+	conditions := make([]string, 0)
+	for _, c := range req.Conditions {
+		conditions = append(conditions, fmt.Sprintf("%s:%s", c.Id, c.Operator))
+	}
+	sort.Strings(conditions)
+	orders := make([]string, 0)
+	for _, o := range req.OrderColumns {
+		orders = append(orders, fmt.Sprintf("%s:%t", o.ColumnId, o.IsDesc))
+	}
+	shape := fmt.Sprintf("%s|%s|%s", req.SearchType, strings.Join(conditions, ","), strings.Join(orders, ","))
+	sum := sha1.Sum([]byte(shape))
+	return hex.EncodeToString(sum[:8])
+}
+
+// requestLogger 并发安全地往 jsonl 文件追加记录
+type requestLogger struct {
+	mu      sync.Mutex
+	file    *os.File
+	writer  *bufio.Writer
+	encoder *json.Encoder
+	count   int
+}
+
+func newRequestLogger(fileName string) (*requestLogger, error) {
+	if fileName == "" {
+		return nil, nil
+	}
+	file, err := os.Create(fileName)
+	if err != nil {
+		return nil, err
+	}
+	writer := bufio.NewWriter(file)
+	return &requestLogger{
+		file:    file,
+		writer:  writer,
+		encoder: json.NewEncoder(writer),
+	}, nil
+}
+
+func (l *requestLogger) write(record *requestRecord) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.count++
+	return l.encoder.Encode(record)
+}
+
+func (l *requestLogger) close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.writer.Flush(); err != nil {
+		return err
+	}
+	return l.file.Close()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+)
+
+var latencyTolerance = flag.Float64("latency-tolerance", 10, "compare: max increase(%) of latency before it is a regression")
+var ratioTolerance = flag.Float64("ratio-tolerance", 1, "compare: max increase of error/timeOut ratio(percentage points) before it is a regression")
+
+// metricDiff 一个指标的对比结果
+type metricDiff struct {
+	name       string
+	base, head float64
+	regression bool
+}
+
+// compareReports 对比两次压测报告，有指标超出容忍范围时退出码为 1
+func compareReports(baseFileName string, headFileName string) {
+	if baseFileName == "" || headFileName == "" {
+		log.Printf("usage: compare <base report> <new report>")
+		os.Exit(2)
+	}
+	base, err := loadRunReport(baseFileName)
+	if err != nil {
+		log.Printf("Cannot load report file: %s, err: [%v]", baseFileName, err)
+		os.Exit(2)
+	}
+	head, err := loadRunReport(headFileName)
+	if err != nil {
+		log.Printf("Cannot load report file: %s, err: [%v]", headFileName, err)
+		os.Exit(2)
+	}
+
+	diffs := compareStats(base.Stats, head.Stats)
+	regressions := 0
+	log.Printf("%-20s %12s %12s %10s", "metric", "base", "new", "diff")
+	for _, d := range diffs {
+		mark := ""
+		if d.regression {
+			mark = "  REGRESSION"
+			regressions++
+		}
+		log.Printf("%-20s %12.5f %12.5f %+10.2f%s", d.name, d.base, d.head, d.head-d.base, mark)
+	}
+	if regressions > 0 {
+		log.Printf("%d regressions", regressions)
+		os.Exit(1)
+	}
+	log.Printf("no regression")
+}
+
+func compareStats(base statsReport, head statsReport) []metricDiff {
+	diffs := make([]metricDiff, 0)
+	latency := func(name string, b, h float64) {
+		diffs = append(diffs, metricDiff{
+			name:       name,
+			base:       b,
+			head:       h,
+			regression: h > b*(1+*latencyTolerance/100),
+		})
+	}
+	// higherIsWorse 为 false 时比例下降算退化
+	ratioMetric := func(name string, b, h float64, higherIsWorse bool) {
+		change := h - b
+		if !higherIsWorse {
+			change = -change
+		}
+		diffs = append(diffs, metricDiff{
+			name:       name,
+			base:       b,
+			head:       h,
+			regression: change > *ratioTolerance,
+		})
+	}
+
+	ratioMetric("errorRatio", base.ErrorRatio, head.ErrorRatio, true)
+	ratioMetric("timeOutRatio", base.TimeOutRatio, head.TimeOutRatio, true)
+	ratioMetric("successRatio", base.SuccessRatio, head.SuccessRatio, false)
+	latency("all.mean", base.All.Mean, head.All.Mean)
+	for _, q := range reportQuantiles {
+		name := percentileName(q)
+		latency("all."+name, base.All.Percentiles[name], head.All.Percentiles[name])
+	}
+	latency("success.mean", base.Success.Mean, head.Success.Mean)
+	for _, q := range reportQuantiles {
+		name := percentileName(q)
+		latency("success."+name, base.Success.Percentiles[name], head.Success.Percentiles[name])
+	}
+	return diffs
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+
+	"github.com/twitchtv/twirp"
+)
+
+var errorSamples = flag.Int("error-samples", 3, "sample messages kept for each error class")
+
+// 错误分类：
+// context/*   客户端自己取消或超时
+// transport/* 连接层面的错误，请求可能没到服务端
+// twirp/*     服务端返回的 twirp 错误码
+const (
+	errorCanceled      = "context/canceled"
+	errorDeadline      = "context/deadline_exceeded"
+	errorConnRefused   = "transport/connection_refused"
+	errorConnReset     = "transport/connection_reset"
+	errorEOF           = "transport/eof"
+	errorClientTimeout = "transport/client_timeout"
+	errorTransport     = "transport/other"
+	errorTwirpPrefix   = "twirp/"
+	errorUnknown       = "other"
+)
+
+// transportPatterns twirp 客户端会把连接错误包装成 internal 错误，
+// 不一定能拿到原始错误，所以先按错误信息匹配
+// http.Client 的超时信息里也有 context deadline exceeded，要放在前面
+var transportPatterns = []struct {
+	pattern string
+	class   string
+}{
+	{"Client.Timeout", errorClientTimeout},
+	{"i/o timeout", errorClientTimeout},
+	{"context canceled", errorCanceled},
+	{"context deadline exceeded", errorDeadline},
+	{"connection refused", errorConnRefused},
+	{"connection reset", errorConnReset},
+	{"broken pipe", errorConnReset},
+	{"EOF", errorEOF},
+	{"no such host", errorTransport},
+	{"failed to do request", errorTransport},
+	{"failed to read response body", errorTransport},
+}
+
+// clientErrorPrefixes twirp 客户端自己包装的错误信息前缀，这些错误不是服务端返回的
+var clientErrorPrefixes = []string{"failed to do request", "failed to read response body", "aborted because context was done"}
+
+// classifyError 服务端返回的 twirp 错误按错误码分类，即使信息里有 EOF 之类的字样；
+// 只有 twirp 客户端包装的错误和非 twirp 错误才按连接错误分类
+func classifyError(err error) string {
+	var twerr twirp.Error
+	if errors.As(err, &twerr) {
+		if isClientError(twerr) {
+			if class := transportClass(err); class != "" {
+				return class
+			}
+		}
+		return errorTwirpPrefix + string(twerr.Code())
+	}
+	if class := transportClass(err); class != "" {
+		return class
+	}
+	return errorUnknown
+}
+
+// isClientError twirp 客户端包装的错误带有 cause meta，或者信息以固定的前缀开头
+func isClientError(twerr twirp.Error) bool {
+	if twerr.Meta("cause") != "" {
+		return true
+	}
+	for _, prefix := range clientErrorPrefixes {
+		if strings.HasPrefix(twerr.Msg(), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// transportClass 返回连接层面的错误分类，不是连接错误时返回空
+func transportClass(err error) string {
+	message := err.Error()
+	for _, p := range transportPatterns {
+		if strings.Contains(message, p.pattern) {
+			return p.class
+		}
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		return errorCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return errorDeadline
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return errorConnRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+		return errorConnReset
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return errorEOF
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return errorClientTimeout
+	}
+	return ""
+}
+
+// errorClass 一类错误的次数和前几条错误信息
+type errorClass struct {
+	Count   int
+	Samples []string
+}
+
+func (c *errorClass) add(count int, samples ...string) {
+	c.Count += count
+	for _, sample := range samples {
+		if len(c.Samples) >= *errorSamples {
+			break
+		}
+		c.Samples = append(c.Samples, sample)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+	"testing"
+
+	"github.com/twitchtv/twirp"
+)
+
+// timeoutError 模拟 net.Error 的超时
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "slow" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"canceled", context.Canceled, errorCanceled},
+		{"wrapped deadline", fmt.Errorf("search: %w", context.DeadlineExceeded), errorDeadline},
+		{"eof", io.EOF, errorEOF},
+		{"broken pipe", fmt.Errorf("write: %w", syscall.EPIPE), errorConnReset},
+		{"net timeout", timeoutError{}, errorClientTimeout},
+		{"unknown", errors.New("boom"), errorUnknown},
+
+		// 服务端返回的错误按错误码分类，不看信息里的字样
+		{"server internal with eof", twirp.NewError(twirp.Internal, "es: unexpected EOF"), "twirp/internal"},
+		{"server unavailable", twirp.NewError(twirp.Unavailable, "redis: connection refused"), "twirp/unavailable"},
+		{"server deadline", twirp.NewError(twirp.DeadlineExceeded, "context deadline exceeded"), "twirp/deadline_exceeded"},
+		{"server invalid argument", twirp.InvalidArgumentError("conditions", "unknown column"), "twirp/invalid_argument"},
+
+		// twirp 客户端包装的错误按原始错误分类
+		{"client connection refused", twirp.InternalErrorWith(errors.New(`failed to do request: Post "http://localhost:8081/twirp/Search": dial tcp 127.0.0.1:8081: connect: connection refused`)), errorConnRefused},
+		{"client connection reset", twirp.InternalErrorWith(fmt.Errorf("failed to do request: %w", syscall.ECONNRESET)), errorConnReset},
+		{"client timeout", twirp.InternalErrorWith(errors.New(`failed to do request: Post "http://localhost:8081": net/http: request canceled (Client.Timeout exceeded while awaiting headers)`)), errorClientTimeout},
+		{"client canceled", twirp.InternalErrorWith(fmt.Errorf("failed to do request: %w", context.Canceled)), errorCanceled},
+		{"client context done", twirp.InternalErrorWith(fmt.Errorf("aborted because context was done: %w", context.DeadlineExceeded)), errorDeadline},
+		{"client body eof", twirp.InternalErrorWith(fmt.Errorf("failed to read response body: %w", io.ErrUnexpectedEOF)), errorEOF},
+		{"client prefix without cause", twirp.NewError(twirp.Internal, "failed to do request: proxyconnect tcp"), errorTransport},
+		// 有 cause 但不是连接错误，还是按错误码
+		{"client cause without transport error", twirp.InternalErrorWith(errors.New("failed to marshal json request")), "twirp/internal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyError(tt.err); got != tt.want {
+				t.Errorf("classifyError(%v) = %s, want %s", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var historyFile = flag.String("history", "bench_history.db", "local store of run reports, empty means do not save")
+var runTags = tagsFlag{}
+
+func init() {
+	flag.Var(runTags, "tag", "tag of the run as key=value, can be repeated")
+}
+
+var runsBucket = []byte("runs")
+
+// tagsFlag 可以重复的 key=value 参数
+type tagsFlag map[string]string
+
+func (t tagsFlag) String() string {
+	pairs := make([]string, 0)
+	for k, v := range t {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (t tagsFlag) Set(value string) error {
+	arr := strings.SplitN(value, "=", 2)
+	if len(arr) != 2 || arr[0] == "" {
+		return fmt.Errorf("tag should be key=value, got %q", value)
+	}
+	t[arr[0]] = arr[1]
+	return nil
+}
+
+// matches 报告的 tag 包含 t 中所有 tag
+func (t tagsFlag) matches(tags map[string]string) bool {
+	for k, v := range t {
+		if tags[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// newRunID 按开始时间生成，按字典序排列就是时间顺序
+func newRunID(start time.Time) string {
+	return start.Format("20060102-150405.000")
+}
+
+func openHistory(fileName string) (*bolt.DB, error) {
+	return bolt.Open(fileName, 0644, &bolt.Options{Timeout: time.Second})
+}
+
+func saveReports(fileName string, reports ...*runReport) error {
+	db, err := openHistory(fileName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(runsBucket)
+		if err != nil {
+			return err
+		}
+		for _, report := range reports {
+			data, err := json.Marshal(report)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(report.ID), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// loadReports 按开始时间顺序返回所有报告
+func loadReports(fileName string) ([]*runReport, error) {
+	db, err := openHistory(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	reports := make([]*runReport, 0)
+	err = db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(runsBucket)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			var report runReport
+			if err := json.Unmarshal(v, &report); err != nil {
+				return fmt.Errorf("run %s: %v", k, err)
+			}
+			reports = append(reports, &report)
+			return nil
+		})
+	})
+	// 导入的旧数据 id 不是按时间生成的
+	sort.SliceStable(reports, func(i, j int) bool {
+		return reports[i].Start.Before(reports[j].Start)
+	})
+	return reports, err
+}
+
+// historyCommand
+//
+//	history list [-tag k=v]
+//	history show <run id>
+//	history trend -metric p99 [-tag k=v] [-since 2020-03-01]
+func historyCommand(args []string) {
+	if len(args) == 0 {
+		log.Printf("usage: history list|show|trend")
+		os.Exit(2)
+	}
+	fs := flag.NewFlagSet("history "+args[0], flag.ExitOnError)
+	tags := tagsFlag{}
+	fs.Var(tags, "tag", "only runs with this tag, can be repeated")
+	metric := fs.String("metric", "p99", "metric of trend, see metricValue")
+	since := fs.String("since", "", "only runs started after this date(2006-01-02)")
+	fs.Parse(args[1:])
+
+	reports, err := loadReports(*historyFile)
+	if err != nil {
+		log.Printf("Cannot load history: %s, err: [%v]", *historyFile, err)
+		os.Exit(1)
+	}
+	var sinceTime time.Time
+	if *since != "" {
+		sinceTime, err = time.ParseInLocation(dateFormat, *since, time.Local)
+		if err != nil {
+			log.Printf("Invalid since: %s, err: [%v]", *since, err)
+			os.Exit(2)
+		}
+	}
+	selected := make([]*runReport, 0)
+	for _, report := range reports {
+		if tags.matches(report.Tags) && !report.Start.Before(sinceTime) {
+			selected = append(selected, report)
+		}
+	}
+
+	switch args[0] {
+	case "list":
+		for _, r := range selected {
+			fmt.Printf("%s  %-40s  q=%s l=%s c=%s  p99=%.5fs  errorRatio=%.2f%%  timeOutRatio=%.2f%%\n",
+				r.ID, tagsFlag(r.Tags).String(), r.Flags["q"], r.Flags["l"], r.Flags["c"],
+				r.Stats.All.Percentiles["p99"], r.Stats.ErrorRatio, r.Stats.TimeOutRatio)
+		}
+	case "show":
+		for _, r := range reports {
+			if r.ID != fs.Arg(0) {
+				continue
+			}
+			data, _ := json.MarshalIndent(r, "", "  ")
+			fmt.Println(string(data))
+			return
+		}
+		log.Printf("run %q not found", fs.Arg(0))
+		os.Exit(1)
+	case "trend":
+		var first float64
+		for i, r := range selected {
+			value, ok := metricValue(r, *metric)
+			if !ok {
+				log.Printf("unknown metric %q", *metric)
+				os.Exit(2)
+			}
+			if i == 0 {
+				first = value
+			}
+			change := 0.0
+			if first != 0 {
+				change = (value - first) / first * 100
+			}
+			fmt.Printf("%s  %s  %s=%.5f  %+.2f%%\n", r.ID, r.Start.Format(dateFormat), *metric, value, change)
+		}
+	default:
+		log.Printf("unknown history command %q", args[0])
+		os.Exit(2)
+	}
+}
+
+// metricValue 支持 errorRatio successRatio timeOutRatio mean p50 ...，
+// 延时默认是全部请求的，success.p99 这种是有结果的请求的，full.p99 这种是某个 outcome 的
+func metricValue(r *runReport, metric string) (float64, bool) {
+	switch metric {
+	case "errorRatio":
+		return r.Stats.ErrorRatio, true
+	case "successRatio":
+		return r.Stats.SuccessRatio, true
+	case "timeOutRatio":
+		return r.Stats.TimeOutRatio, true
+	}
+	latency := r.Stats.All
+	if arr := strings.SplitN(metric, ".", 2); len(arr) == 2 {
+		if arr[0] == "success" {
+			latency = r.Stats.Success
+			metric = arr[1]
+		} else if outcome, ok := r.Stats.Outcomes[arr[0]]; ok {
+			latency = outcome.latencyReport
+			metric = arr[1]
+		}
+	}
+	switch metric {
+	case "mean":
+		return latency.Mean, true
+	case "min":
+		return latency.Min, true
+	case "max":
+		return latency.Max, true
+	}
+	value, ok := latency.Percentiles[metric]
+	return value, ok
+}
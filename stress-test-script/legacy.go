@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 导入以前手工贴在注释里的结果，或者保存下来的 calculate 日志，例如：
+//
+//	// ==================== with redis cache =====================
+//	// f: -q 100 -l 1000 -m 10 -c 6 => avg=5.49227s, min=0.03498s, max=16.63220s, failed=37, ...
+//	// 2020/03/10 17:20:18 test_company.go:240: success: avg=5.86417s, min=0.15757s, ...
+//	// n: => avg=0.81029s, ...
+//
+// "=>" 前面是当时的参数，没有参数时沿用上一条的参数；
+// 标题（"=== xxx ===" 或者夹在 "=====" 之间的第一行）作为 section tag，f:/n: 这类标记作为 mark tag
+var (
+	logPrefixRegexp = regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2})(?: \S+\.go:\d+:)? `)
+	markRegexp      = regexp.MustCompile(`^(\w):\s*`)
+	headingRegexp   = regexp.MustCompile(`^=+\s*(.*?)\s*=+$`)
+	ruleRegexp      = regexp.MustCompile(`^=+$`)
+)
+
+const legacyTimeFormat = "2006/01/02 15:04:05"
+
+// legacyFlags 以前的脚本只有这几个参数，没写出来的就是默认值
+var legacyFlags = []string{"q", "p", "t", "l", "c", "m"}
+
+type legacyParser struct {
+	fileName string
+	lineNo   int
+	// goSource 从 .go 文件的注释里导入
+	goSource bool
+
+	section     string
+	lastIsRule  bool
+	flags       map[string]string
+	current     *runReport
+	currentLine int
+	reports     []*runReport
+}
+
+func importCommand(fileNames []string) {
+	if len(fileNames) == 0 {
+		log.Printf("usage: import <file>...")
+		os.Exit(2)
+	}
+	reports := make([]*runReport, 0)
+	for _, fileName := range fileNames {
+		parsed, err := parseLegacyResults(fileName)
+		if err != nil {
+			log.Printf("Cannot parse file: %s, err: [%v]", fileName, err)
+			os.Exit(1)
+		}
+		log.Printf("%s: %d runs", fileName, len(parsed))
+		reports = append(reports, parsed...)
+	}
+	if *historyFile == "" {
+		return
+	}
+	if err := saveReports(*historyFile, reports...); err != nil {
+		log.Printf("Cannot save history: %s, err: [%v]", *historyFile, err)
+		os.Exit(1)
+	}
+}
+
+func parseLegacyResults(fileName string) ([]*runReport, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	p := &legacyParser{
+		fileName: fileName,
+		goSource: strings.HasSuffix(fileName, ".go"),
+		flags:    legacyDefaultFlags(),
+		reports:  make([]*runReport, 0),
+	}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		p.lineNo++
+		p.parseLine(scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	p.finish()
+	return p.reports, nil
+}
+
+func legacyDefaultFlags() map[string]string {
+	flags := make(map[string]string)
+	for _, name := range legacyFlags {
+		if f := flag.Lookup(name); f != nil {
+			flags[name] = f.DefValue
+		}
+	}
+	return flags
+}
+
+func (p *legacyParser) parseLine(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+	// go 源文件里的代码把前后两段注释分开，标题不能带到下一段
+	if p.goSource && !strings.HasPrefix(line, "//") {
+		p.section = ""
+		p.lastIsRule = false
+		return
+	}
+	line = strings.TrimSpace(strings.TrimPrefix(line, "//"))
+	if line == "" {
+		return
+	}
+
+	var logTime time.Time
+	if m := logPrefixRegexp.FindStringSubmatch(line); m != nil {
+		logTime, _ = time.ParseInLocation(legacyTimeFormat, m[1], time.Local)
+		line = line[len(m[0]):]
+	}
+
+	if !strings.Contains(line, "avg=") && !strings.Contains(line, "p50=") {
+		p.parseHeading(line)
+		return
+	}
+	p.lastIsRule = false
+
+	// 分阶段的结果不导入
+	if strings.HasPrefix(line, "[") {
+		return
+	}
+	switch {
+	case strings.HasPrefix(line, "success: "):
+		p.parseSuccess(strings.TrimPrefix(line, "success: "), logTime)
+	case strings.HasPrefix(line, "all: "):
+		if p.current != nil {
+			parsePercentiles(strings.TrimPrefix(line, "all: "), &p.current.Stats.All)
+		}
+	case strings.Contains(line, "avg="):
+		p.parseResult(line, logTime)
+	}
+	// 其他带 p50= 的行（outcome xxx: 和每个时间段的 sent=...）不导入
+}
+
+func (p *legacyParser) parseHeading(line string) {
+	if ruleRegexp.MatchString(line) {
+		p.lastIsRule = true
+		return
+	}
+	if m := headingRegexp.FindStringSubmatch(line); m != nil {
+		p.section = m[1]
+		p.lastIsRule = true
+		return
+	}
+	// f: xxx 这种是标记的说明
+	if p.lastIsRule && !markRegexp.MatchString(line) {
+		p.section = line
+	}
+	p.lastIsRule = false
+}
+
+// parseResult 解析第一行：[mark:] [flags =>] avg=..., min=..., ...
+func (p *legacyParser) parseResult(line string, logTime time.Time) {
+	p.finish()
+
+	index := strings.Index(line, "avg=")
+	prefix, values := strings.TrimSpace(line[:index]), line[index:]
+	var mark string
+	if m := markRegexp.FindStringSubmatch(prefix); m != nil {
+		mark = m[1]
+		prefix = prefix[len(m[0]):]
+	}
+	prefix = strings.TrimSpace(strings.TrimSuffix(prefix, "=>"))
+	if prefix != "" {
+		p.flags = legacyDefaultFlags()
+		fields := strings.Fields(prefix)
+		for i := 0; i+1 < len(fields); i += 2 {
+			p.flags[strings.TrimLeft(fields[i], "-")] = fields[i+1]
+		}
+	}
+
+	report := &runReport{
+		Command: "legacy",
+		Flags:   make(map[string]string),
+		Tags:    map[string]string{"source": filepath.Base(p.fileName)},
+		Start:   logTime,
+		End:     logTime,
+	}
+	for k, v := range p.flags {
+		report.Flags[k] = v
+	}
+	for k, v := range runTags {
+		report.Tags[k] = v
+	}
+	if p.section != "" {
+		report.Tags["section"] = p.section
+	}
+	if mark != "" {
+		report.Tags["mark"] = mark
+	}
+
+	kv := parseKeyValues(values)
+	stats := &report.Stats
+	stats.All = latencyReport{Mean: kv["avg"], Min: kv["min"], Max: kv["max"], Percentiles: make(map[string]float64)}
+	stats.Failed = int(kv["failed"])
+	stats.SuccessCount = int(kv["successCount"])
+	stats.SuccessRatio = kv["successRatio"]
+	stats.TimeOut = int(kv["timeOut"])
+	stats.TimeOutRatio = kv["timeOutRatio"]
+	// 以前的输出没有总数，用比例反推
+	switch {
+	case stats.SuccessRatio > 0:
+		stats.Total = int(math.Round(float64(stats.SuccessCount) / stats.SuccessRatio * 100))
+	case stats.TimeOutRatio > 0:
+		stats.Total = int(math.Round(float64(stats.TimeOut) / stats.TimeOutRatio * 100))
+	}
+	stats.ErrorRatio = ratio(stats.Failed, stats.Total)
+
+	p.current = report
+	p.currentLine = p.lineNo
+}
+
+// parseSuccess 解析第二行：success: avg=..., min=..., max=..., timeOut=..., timeOutRatio=...
+// 或者百分位数：success: p50=..., p90=...
+func (p *legacyParser) parseSuccess(line string, logTime time.Time) {
+	if p.current == nil {
+		return
+	}
+	if !logTime.IsZero() && p.current.Start.IsZero() {
+		p.current.Start = logTime
+		p.current.End = logTime
+	}
+	if strings.HasPrefix(line, "p50=") {
+		parsePercentiles(line, &p.current.Stats.Success)
+		return
+	}
+	kv := parseKeyValues(line)
+	p.current.Stats.Success = latencyReport{Mean: kv["avg"], Min: kv["min"], Max: kv["max"], Percentiles: make(map[string]float64)}
+}
+
+func (p *legacyParser) finish() {
+	if p.current == nil {
+		return
+	}
+	// 同一段结果可能被复制到几个文件里，id 带上文件名，避免导入时互相覆盖
+	if p.current.Start.IsZero() {
+		p.current.ID = fmt.Sprintf("legacy-%s-%d", filepath.Base(p.fileName), p.currentLine)
+	} else {
+		p.current.ID = fmt.Sprintf("legacy-%s-%s", filepath.Base(p.fileName), newRunID(p.current.Start))
+	}
+	p.reports = append(p.reports, p.current)
+	p.current = nil
+}
+
+func parsePercentiles(line string, latency *latencyReport) {
+	if latency.Percentiles == nil {
+		latency.Percentiles = make(map[string]float64)
+	}
+	for k, v := range parseKeyValues(line) {
+		if k == "max" {
+			latency.Max = v
+			continue
+		}
+		latency.Percentiles[k] = v
+	}
+}
+
+// parseKeyValues 解析 "avg=0.1s, failed=0, successRatio=58.38%"，去掉单位
+func parseKeyValues(line string) map[string]float64 {
+	kv := make(map[string]float64)
+	for _, pair := range strings.Split(line, ",") {
+		arr := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(arr) != 2 {
+			continue
+		}
+		value := strings.TrimRight(arr[1], "s%")
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			continue
+		}
+		kv[arr[0]] = n
+	}
+	return kv
+}
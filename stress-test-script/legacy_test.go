@@ -0,0 +1,140 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLegacyResults(t *testing.T) {
+	type run struct {
+		index       int
+		id          string
+		q           string
+		l           string
+		section     string
+		mark        string
+		mean        float64
+		successMean float64
+		total       int
+	}
+	tests := []struct {
+		name     string
+		fileName string
+		count    int
+		runs     []run
+	}{
+		{
+			// 从 test_company.go 里复制的历史结果
+			name:     "comment block",
+			fileName: "testdata/legacy_results.txt",
+			count:    38,
+			runs: []run{
+				{index: 0, id: "legacy-legacy_results.txt-20200306-110916.000", q: "100", l: "500", mean: 18.43444, successMean: 31.49749, total: 6000},
+				// 没有 success 行和时间
+				{index: 3, id: "legacy-legacy_results.txt-6", q: "50", l: "500", mean: 0.42441},
+				{index: 12, q: "200", l: "500", section: "full data from db", mean: 9.99102, successMean: 20.79549, total: 2000},
+				// 没有参数时沿用上一条
+				{index: 14, q: "50", l: "500", section: "full data from db", mean: 3.99284, successMean: 4.29264, total: 500},
+				{index: 16, q: "50", l: "500", section: "with redis cache", mark: "f", mean: 0.34985, successMean: 0.41293, total: 3000},
+				{index: 17, q: "50", l: "500", section: "with redis cache", mark: "n", mean: 0.29256, successMean: 0.33601, total: 3000},
+				{index: 27, q: "200", l: "1000", section: "以下测试一直不清空 redis", mark: "f", mean: 2.47449, successMean: 3.18126, total: 12001},
+				{index: 37, q: "150", l: "1000", section: "以下测试模拟 fulldata 数据全部放在 redis 中的性能", mean: 1.69894, successMean: 2.58271, total: 1500},
+			},
+		},
+		{
+			// 现在的 calculate 输出，outcome、时间序列和分页的结果不导入
+			name:     "calculate log",
+			fileName: "testdata/calculate.log",
+			count:    1,
+			runs: []run{
+				{index: 0, id: "legacy-calculate.log-20200601-100100.000", q: "50", l: "500", mean: 0.12, successMean: 0.11, total: 6000},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reports, err := parseLegacyResults(tt.fileName)
+			if err != nil {
+				t.Fatalf("parseLegacyResults() error = %v", err)
+			}
+			if len(reports) != tt.count {
+				t.Fatalf("parseLegacyResults() got %d runs, want %d", len(reports), tt.count)
+			}
+			for _, want := range tt.runs {
+				got := reports[want.index]
+				if want.id != "" && got.ID != want.id {
+					t.Errorf("run %d: id = %s, want %s", want.index, got.ID, want.id)
+				}
+				if got.Flags["q"] != want.q || got.Flags["l"] != want.l {
+					t.Errorf("run %d: flags = %v, want q=%s l=%s", want.index, got.Flags, want.q, want.l)
+				}
+				if got.Tags["section"] != want.section || got.Tags["mark"] != want.mark {
+					t.Errorf("run %d: tags = %v, want section=%q mark=%q", want.index, got.Tags, want.section, want.mark)
+				}
+				if got.Stats.All.Mean != want.mean || got.Stats.Success.Mean != want.successMean {
+					t.Errorf("run %d: mean = %g/%g, want %g/%g", want.index, got.Stats.All.Mean, got.Stats.Success.Mean, want.mean, want.successMean)
+				}
+				if got.Stats.Total != want.total {
+					t.Errorf("run %d: total = %d, want %d", want.index, got.Stats.Total, want.total)
+				}
+			}
+		})
+	}
+}
+
+// test_company.go 里的代码把两段注释分开，choiceConditions 上面的结果不属于前面的标题
+func TestParseLegacyGoSource(t *testing.T) {
+	reports, err := parseLegacyResults("test_company.go")
+	if err != nil {
+		t.Fatalf("parseLegacyResults() error = %v", err)
+	}
+	if len(reports) < 2 {
+		t.Fatalf("parseLegacyResults() got %d runs", len(reports))
+	}
+	for _, report := range reports[len(reports)-2:] {
+		if report.Flags["q"] != "50" || report.Flags["p"] != "50" {
+			t.Errorf("%s: flags = %v, want the runs above choiceConditions", report.ID, report.Flags)
+		}
+		if section, ok := report.Tags["section"]; ok {
+			t.Errorf("%s: section = %q, want none", report.ID, section)
+		}
+	}
+	// 和 testdata/legacy_results.txt 是同一段结果，id 不能一样
+	copied, err := parseLegacyResults("testdata/legacy_results.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make(map[string]bool)
+	for _, report := range copied {
+		ids[report.ID] = true
+	}
+	for _, report := range reports {
+		if ids[report.ID] {
+			t.Errorf("id %s is imported from both files", report.ID)
+		}
+	}
+}
+
+func TestParseLegacyPercentiles(t *testing.T) {
+	reports, err := parseLegacyResults("testdata/calculate.log")
+	if err != nil || len(reports) != 1 {
+		t.Fatalf("parseLegacyResults() = %d runs, err = %v", len(reports), err)
+	}
+	stats := reports[0].Stats
+	want := map[string]float64{"p50": 0.1, "p90": 0.2, "p95": 0.3, "p99": 0.5, "p99.9": 0.8}
+	for k, v := range want {
+		if stats.All.Percentiles[k] != v {
+			t.Errorf("all %s = %g, want %g", k, stats.All.Percentiles[k], v)
+		}
+	}
+	if stats.Success.Percentiles["p50"] != 0.09 || stats.Success.Max != 0.8 {
+		t.Errorf("success = %+v, want p50=0.09 max=0.8", stats.Success)
+	}
+	if stats.Failed != 6 || stats.TimeOut != 12 {
+		t.Errorf("failed = %d, timeOut = %d, want 6, 12", stats.Failed, stats.TimeOut)
+	}
+	start := time.Date(2020, 6, 1, 10, 1, 0, 0, time.Local)
+	if !reports[0].Start.Equal(start) {
+		t.Errorf("start = %v, want %v", reports[0].Start, start)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+
+	pb "gitlab.com/momentum-valley/advanced-search/rpc/advanced-search"
+)
+
+// operatorArity 一个 operator 需要几个值
+type operatorArity int
+
+const (
+	// singleValue 比如 AFTER、BEFORE，一个值
+	singleValue operatorArity = iota
+	// rangeValue BETWEEN，两个值
+	rangeValue
+	// setValue 比如 INCLUDES_ANY，一个或多个值
+	setValue
+)
+
+// operatorSpec 一个 operator 需要几个值，以及可以用于哪些 value type
+type operatorSpec struct {
+	arity      operatorArity
+	valueTypes []ValueType
+}
+
+var (
+	// orderedValueTypes 可以比较大小的 value type
+	orderedValueTypes = []ValueType{NumberValueType, AmountValueType, DateValueType}
+	// setValueTypes 按集合匹配的 value type
+	setValueTypes = []ValueType{TextValueType, TextArrayValueType, NumberArrayValueType}
+)
+
+// operatorSpecs operator 的名字 -> 需要几个值和可以用于哪些 value type，
+// 按名字对应 pb.Operator，pb 里没有的名字不用；
+// pb 新加的 operator 不在这里时启动会提醒，压测时不会用到，要用的话在这里加上
+var operatorSpecs = map[string]operatorSpec{
+	"AFTER":        {arity: singleValue, valueTypes: orderedValueTypes},
+	"BEFORE":       {arity: singleValue, valueTypes: orderedValueTypes},
+	"BETWEEN":      {arity: rangeValue, valueTypes: orderedValueTypes},
+	"INCLUDES_ANY": {arity: setValue, valueTypes: setValueTypes},
+	"INCLUDES_ALL": {arity: setValue, valueTypes: setValueTypes},
+	"EXCLUDES":     {arity: setValue, valueTypes: setValueTypes},
+}
+
+// operatorArities pb 里有的 operator 需要几个值
+var operatorArities = arityOfOperators()
+
+// operatorsByValueType 每种 value type 默认可以用的 operator，按 pb.Operator 的值排序
+var operatorsByValueType = groupOperators()
+
+func arityOfOperators() map[pb.Operator]operatorArity {
+	arities := make(map[pb.Operator]operatorArity)
+	for name, spec := range operatorSpecs {
+		if value, ok := pb.Operator_value[name]; ok {
+			arities[pb.Operator(value)] = spec.arity
+		}
+	}
+	return arities
+}
+
+func groupOperators() map[ValueType][]pb.Operator {
+	operators := make([]pb.Operator, 0)
+	for operator := range operatorArities {
+		operators = append(operators, operator)
+	}
+	sort.Slice(operators, func(i, j int) bool { return operators[i] < operators[j] })
+
+	groups := make(map[ValueType][]pb.Operator)
+	for _, operator := range operators {
+		for _, valueType := range operatorSpecs[operator.String()].valueTypes {
+			groups[valueType] = append(groups[valueType], operator)
+		}
+	}
+	return groups
+}
+
+// unknownOperators pb.Operator 里不在 operatorSpecs 的 operator，按名字排序
+func unknownOperators() []string {
+	unknown := make([]string, 0)
+	for _, name := range pb.Operator_name {
+		if _, ok := operatorSpecs[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// fitArity 按 operator 需要的个数截取生成的值
+func fitArity(operator pb.Operator, values []string) []string {
+	if len(values) > 1 && operatorArities[operator] == singleValue {
+		return values[:1]
+	}
+	return values
+}
+
+// randWeighted 按权重随机取一个下标，weights 都是正数
+func randWeighted(rng *rand.Rand, weights []int) int {
+	total := 0
+	for _, w := range weights {
+		total += w
+	}
+	n := rng.Intn(total)
+	for i, w := range weights {
+		if n < w {
+			return i
+		}
+		n -= w
+	}
+	return len(weights) - 1
+}
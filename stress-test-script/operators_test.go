@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+
+	pb "gitlab.com/momentum-valley/advanced-search/rpc/advanced-search"
+)
+
+func TestOperatorSpecs(t *testing.T) {
+	for name, valueType := range valueTypeNames {
+		if len(operatorsByValueType[valueType]) == 0 {
+			t.Errorf("value type %s has no operator", name)
+		}
+	}
+	for operator := range operatorArities {
+		if _, ok := operatorSpecs[operator.String()]; !ok {
+			t.Errorf("operator %s is not in operatorSpecs", operator)
+		}
+	}
+}
+
+// pb 新加了 operatorSpecs 里没有的 operator，提醒并且不用它
+func TestUnknownOperators(t *testing.T) {
+	const value = 99
+	pb.Operator_name[value] = "IS_EMPTY"
+	pb.Operator_value["IS_EMPTY"] = value
+	defer func() {
+		delete(pb.Operator_name, value)
+		delete(pb.Operator_value, "IS_EMPTY")
+	}()
+
+	found := false
+	for _, name := range unknownOperators() {
+		if _, ok := operatorSpecs[name]; ok {
+			t.Errorf("%s is in operatorSpecs", name)
+		}
+		found = found || name == "IS_EMPTY"
+	}
+	if !found {
+		t.Errorf("unknownOperators() = %v, want IS_EMPTY", unknownOperators())
+	}
+	if _, ok := arityOfOperators()[pb.Operator(value)]; ok {
+		t.Errorf("IS_EMPTY should not have an arity")
+	}
+	c := &columnSpec{ID: "a", Operators: []string{"IS_EMPTY"}, Generator: "numbers"}
+	if err := c.init(); err == nil {
+		t.Errorf("init() with IS_EMPTY should fail")
+	}
+}
+
+func TestFitArity(t *testing.T) {
+	tests := []struct {
+		operator pb.Operator
+		values   []string
+		want     int
+	}{
+		{pb.Operator_AFTER, []string{"2019-01-01", "2020-01-01"}, 1},
+		{pb.Operator_BETWEEN, []string{"1", "2"}, 2},
+		{pb.Operator_INCLUDES_ANY, []string{"a", "b", "c"}, 3},
+	}
+	for _, tt := range tests {
+		if got := fitArity(tt.operator, tt.values); len(got) != tt.want {
+			t.Errorf("fitArity(%s, %v) = %v, want %d values", tt.operator, tt.values, got, tt.want)
+		}
+	}
+	if got := fitArity(pb.Operator_AFTER, nil); got != nil {
+		t.Errorf("fitArity(AFTER, nil) = %v, want nil", got)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/twitchtv/twirp"
+	pb "gitlab.com/momentum-valley/advanced-search/rpc/advanced-search"
+)
+
+const searchPath = pb.AdvancedSearchPathPrefix + "Search"
+
+// recordCommand 启动一个反向代理，把请求原样转发给 -upstream，
+// 并把每个 Search 请求按 replay 的 jsonl 格式写入文件，包括 upstream 返回的 http 状态码
+func recordCommand(args []string) {
+	flags := flag.NewFlagSet("record", flag.ExitOnError)
+	listen := flags.String("listen", ":8082", "address the recording proxy listens on")
+	output := flags.String("o", "recorded_requests.jsonl", "write recorded requests to this jsonl file")
+	upstreamURL := flags.String("upstream", searchURL, "search service the recording proxy forwards to")
+	flags.Parse(args)
+
+	upstream, err := url.Parse(*upstreamURL)
+	if err == nil && (upstream.Scheme == "" || upstream.Host == "") {
+		err = fmt.Errorf("need scheme and host")
+	}
+	if err != nil {
+		log.Printf("Cannot parse upstream url: %s, err: [%v]", *upstreamURL, err)
+		os.Exit(2)
+	}
+	if *output == "" {
+		log.Printf("record needs an output file")
+		os.Exit(2)
+	}
+	recorded, err := newRequestLogger(*output)
+	if err != nil {
+		log.Printf("Cannot create record file: %s, err: [%v]", *output, err)
+		os.Exit(1)
+	}
+	server := &http.Server{
+		Addr:    *listen,
+		Handler: &recordingProxy{proxy: httputil.NewSingleHostReverseProxy(upstream), recorded: recorded},
+	}
+	go func() {
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+		<-interrupt
+		server.Close()
+	}()
+	log.Printf("recording %s on %s to %s", upstream, *listen, *output)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Printf("Cannot serve on %s, err: [%v]", *listen, err)
+	}
+	if err := recorded.close(); err != nil {
+		log.Printf("Cannot close record file: %s, err: [%v]", *output, err)
+	}
+	log.Printf("recorded %d requests", recorded.count)
+}
+
+type recordingProxy struct {
+	proxy    *httputil.ReverseProxy
+	recorded *requestLogger
+}
+
+func (p *recordingProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != searchPath {
+		p.proxy.ServeHTTP(w, r)
+		return
+	}
+	arrival := time.Now()
+	body, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		log.Printf("Cannot read request body, err: [%v]", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	response := &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+	p.proxy.ServeHTTP(response, r)
+
+	var req pb.SearchRequest
+	if err := decodeTwirp(r.Header.Get("Content-Type"), body, &req); err != nil {
+		log.Printf("Cannot decode search request, err: [%v]", err)
+		return
+	}
+	res := testResult{Cost: time.Since(arrival), Err: response.err()}
+	if res.Err == nil {
+		var result pb.SearchResponse
+		body, err := response.decodedBody()
+		if err == nil {
+			err = decodeTwirp(response.Header().Get("Content-Type"), body, &result)
+		}
+		if err != nil {
+			res.Err = err
+		} else {
+			res.Count = len(result.Nodes)
+		}
+	}
+	record, err := newRequestRecord(&req, arrival, res)
+	if err == nil {
+		record.Status = response.status
+		err = p.recorded.write(record)
+	}
+	if err != nil {
+		log.Printf("Cannot write recorded request, err: [%v]", err)
+	}
+}
+
+// decodeTwirp 按 Content-Type 解析 twirp 的 protobuf 或 json 编码
+func decodeTwirp(contentType string, body []byte, message proto.Message) error {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("bad content type %q: %v", contentType, err)
+	}
+	switch mediaType {
+	case "application/protobuf":
+		return proto.Unmarshal(body, message)
+	case "application/json":
+		unmarshaler := jsonpb.Unmarshaler{AllowUnknownFields: true}
+		return unmarshaler.Unmarshal(bytes.NewReader(body), message)
+	default:
+		return fmt.Errorf("unsupported content type %q", contentType)
+	}
+}
+
+// recordingWriter 转发响应的同时保留一份 status 和 body
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// decodedBody 返回解压后的响应，client 带了 Accept-Encoding 时 upstream 可能返回 gzip
+func (w *recordingWriter) decodedBody() ([]byte, error) {
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		return w.body.Bytes(), nil
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(w.body.Bytes()))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
+// err 把非 200 的响应还原成 twirp.Error，这样和压测时的错误归到同一类
+func (w *recordingWriter) err() error {
+	if w.status == http.StatusOK {
+		return nil
+	}
+	// twirp 的错误总是 json: {"code": "...", "msg": "..."}
+	var twerr struct {
+		Code string `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if json.Unmarshal(w.body.Bytes(), &twerr) == nil && twerr.Code != "" {
+		return twirp.NewError(twirp.ErrorCode(twerr.Code), twerr.Msg)
+	}
+	// 比如 ReverseProxy 连不上 upstream 时返回的 502
+	message := strings.TrimSpace(w.body.String())
+	if message == "" {
+		message = http.StatusText(w.status)
+	}
+	return fmt.Errorf("http %d: %s", w.status, message)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordingProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Header.Get("X-Fail") != "" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"code":"unavailable","msg":"es is down"}`))
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+	upstreamURL, _ := url.Parse(upstream.URL)
+
+	dir, err := ioutil.TempDir("", "record")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "recorded.jsonl")
+	recorded, err := newRequestLogger(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := httptest.NewServer(&recordingProxy{proxy: httputil.NewSingleHostReverseProxy(upstreamURL), recorded: recorded})
+	defer proxy.Close()
+
+	for _, fail := range []bool{false, true} {
+		req, _ := http.NewRequest(http.MethodPost, proxy.URL+searchPath, strings.NewReader(`{"first":5}`))
+		req.Header.Set("Content-Type", "application/json")
+		if fail {
+			req.Header.Set("X-Fail", "1")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if err := recorded.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	records := make([]requestRecord, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record requestRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+	if records[0].Status != http.StatusOK || records[0].Error != "" {
+		t.Errorf("record 0: status = %d, error = %q, want 200 and no error", records[0].Status, records[0].Error)
+	}
+	if records[1].Status != http.StatusServiceUnavailable || !strings.Contains(records[1].Error, "es is down") {
+		t.Errorf("record 1: status = %d, error = %q, want 503 and the twirp error", records[1].Status, records[1].Error)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	pb "gitlab.com/momentum-valley/advanced-search/rpc/advanced-search"
+)
+
+var replaySpeed = flag.Float64("speed", 1, "replay speed, 2 means twice as fast as recorded")
+
+const (
+	replayPhase = "replay"
+	// 一行 jsonl 最长 16MB
+	maxRecordSize = 16 * 1024 * 1024
+)
+
+// replayCommand 按记录的相对时间（除以 -speed）重新发送 jsonl 文件中的请求，
+// 文件格式和 -slow 输出的一样，发送前按 time 排序
+func replayCommand(ctx context.Context, fileName string) {
+	if fileName == "" {
+		log.Printf("usage: replay <requests.jsonl>")
+		return
+	}
+	if *replaySpeed <= 0 {
+		log.Printf("speed should be positive, got %g", *replaySpeed)
+		return
+	}
+	file, err := os.Open(fileName)
+	if err != nil {
+		log.Printf("Cannot open replay file: %s, err: [%v]", fileName, err)
+		return
+	}
+	defer file.Close()
+
+	client := pb.NewAdvancedSearchProtobufClient(searchURL, &http.Client{})
+	log.Printf("replay %s at speed %g", fileName, *replaySpeed)
+	var readErr error
+	start := time.Now()
+	stats := runWith(ctx, 0, func(sendCtx context.Context, queryCtx context.Context) {
+		readErr = replayRequests(sendCtx, queryCtx, client, file)
+	})
+	if readErr != nil {
+		log.Printf("Cannot read replay file: %s, err: [%v]", fileName, readErr)
+	}
+	fmt.Println("done")
+	finishRun(stats, start, time.Now())
+}
+
+// replayRecord 一条要重放的请求
+type replayRecord struct {
+	time time.Time
+	req  *pb.SearchRequest
+}
+
+func replayRequests(sendCtx context.Context, queryCtx context.Context, client pb.AdvancedSearch, file *os.File) error {
+	records, err := readReplayRecords(file)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	first := records[0].time
+	start := time.Now()
+	for _, record := range records {
+		offset := time.Duration(float64(record.time.Sub(first)) / *replaySpeed)
+		intended := start.Add(offset)
+		if !sleepUntil(sendCtx, intended) {
+			return nil
+		}
+		inFlight.Add(1)
+		go func(req *pb.SearchRequest, intended time.Time) {
+			defer inFlight.Done()
+			sendQuery(queryCtx, client, req, intended, replayPhase, 1)
+		}(record.req, intended)
+	}
+	return nil
+}
+
+// readReplayRecords 读取所有记录并按 time 排序，
+// -slow 和 record 都是在请求返回时写入的，文件里的顺序是返回的顺序，不是到达的顺序
+func readReplayRecords(file *os.File) ([]replayRecord, error) {
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxRecordSize)
+	records := make([]replayRecord, 0)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var record requestRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		req := &pb.SearchRequest{}
+		if err := jsonpb.Unmarshal(bytes.NewReader(record.Request), req); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		records = append(records, replayRecord{time: record.Time, req: req})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].time.Before(records[j].time) })
+	return records, nil
+}
+
+func sameFile(a string, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReadReplayRecords(t *testing.T) {
+	// 和 -slow 一样按返回的顺序写入，慢的请求先到达但是后写入
+	content := `{"time":"2020-06-01T10:00:00.300Z","latency":0.1,"count":1,"fingerprint":"c","request":{"first":3}}
+{"time":"2020-06-01T10:00:00.100Z","latency":0.5,"count":1,"fingerprint":"a","request":{"first":1}}
+
+{"time":"2020-06-01T10:00:00.200Z","latency":0.5,"count":1,"fingerprint":"b","request":{"first":2}}
+`
+	file, err := ioutil.TempFile("", "replay-*.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	if _, err := file.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := readReplayRecords(file)
+	if err != nil {
+		t.Fatalf("readReplayRecords() error = %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("readReplayRecords() got %d records, want 3", len(records))
+	}
+	base := time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)
+	for i, record := range records {
+		if record.req.First == nil || record.req.First.Value != int32(i+1) {
+			t.Errorf("record %d: first = %v, want %d", i, record.req.First, i+1)
+		}
+		if offset := record.time.Sub(base); offset != time.Duration(i+1)*100*time.Millisecond {
+			t.Errorf("record %d: offset = %s", i, offset)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// runReport 一次压测的 json 报告，延时单位秒，比例单位 %
+type runReport struct {
+	ID          string                 `json:"id"`
+	Tags        map[string]string      `json:"tags,omitempty"`
+	Command     string                 `json:"command"`
+	Flags       map[string]string      `json:"flags"`
+	Start       time.Time              `json:"start"`
+	End         time.Time              `json:"end"`
+	Seconds     float64                `json:"seconds"`
+	Seed        int64                  `json:"seed,omitempty"`
+	Environment environmentReport      `json:"environment"`
+	Requests    requestsReport         `json:"requests"`
+	Stats       statsReport            `json:"stats"`
+	Phases      map[string]statsReport `json:"phases,omitempty"`
+	// Pages key 是页码
+	Pages map[string]statsReport `json:"pages,omitempty"`
+	// Sorts key 是全部排序列和方向，见 sortKey
+	Sorts map[string]statsReport `json:"sorts,omitempty"`
+}
+
+type requestsReport struct {
+	Sent      int64 `json:"sent"`
+	Completed int64 `json:"completed"`
+	Abandoned int64 `json:"abandoned"`
+}
+
+type environmentReport struct {
+	Hostname   string `json:"hostname"`
+	GoVersion  string `json:"goVersion"`
+	GOOS       string `json:"goos"`
+	GOARCH     string `json:"goarch"`
+	NumCPU     int    `json:"numCPU"`
+	GOMAXPROCS int    `json:"gomaxprocs"`
+	SearchURL  string `json:"searchURL"`
+}
+
+type statsReport struct {
+	Total        int                      `json:"total"`
+	Canceled     int                      `json:"canceled"`
+	Failed       int                      `json:"failed"`
+	ErrorRatio   float64                  `json:"errorRatio"`
+	SuccessCount int                      `json:"successCount"`
+	SuccessRatio float64                  `json:"successRatio"`
+	TimeOut      int                      `json:"timeOut"`
+	TimeOutRatio float64                  `json:"timeOutRatio"`
+	All          latencyReport            `json:"all"`
+	Success      latencyReport            `json:"success"`
+	Errors       map[string]errorReport   `json:"errors,omitempty"`
+	Outcomes     map[string]outcomeReport `json:"outcomes,omitempty"`
+}
+
+type errorReport struct {
+	Count   int      `json:"count"`
+	Ratio   float64  `json:"ratio"`
+	Samples []string `json:"samples,omitempty"`
+}
+
+type outcomeReport struct {
+	Ratio float64 `json:"ratio"`
+	latencyReport
+}
+
+type latencyReport struct {
+	Count       int64              `json:"count"`
+	Mean        float64            `json:"mean"`
+	Min         float64            `json:"min"`
+	Max         float64            `json:"max"`
+	Percentiles map[string]float64 `json:"percentiles"`
+}
+
+func newRunReport(stats *runStats, start time.Time, end time.Time) *runReport {
+	report := &runReport{
+		ID:          newRunID(start),
+		Tags:        runTags,
+		Command:     flag.Arg(0),
+		Flags:       make(map[string]string),
+		Start:       start,
+		End:         end,
+		Seconds:     end.Sub(start).Seconds(),
+		Seed:        *seed,
+		Environment: newEnvironmentReport(),
+		Requests: requestsReport{
+			Sent:      stats.sent,
+			Completed: stats.completed,
+			Abandoned: stats.abandoned,
+		},
+		Stats: newStatsReport(stats.all),
+	}
+	flag.VisitAll(func(f *flag.Flag) {
+		report.Flags[f.Name] = f.Value.String()
+	})
+	if len(stats.byPhase) > 1 {
+		report.Phases = make(map[string]statsReport)
+		for name, phaseStats := range stats.byPhase {
+			report.Phases[name] = newStatsReport(phaseStats)
+		}
+	}
+	if len(stats.byPage) > 1 {
+		report.Pages = make(map[string]statsReport)
+		for page, pageStats := range stats.byPage {
+			report.Pages[strconv.Itoa(page)] = newStatsReport(pageStats)
+		}
+	}
+	if len(stats.bySort) > 1 {
+		report.Sorts = make(map[string]statsReport)
+		for column, sortStats := range stats.bySort {
+			report.Sorts[column] = newStatsReport(sortStats)
+		}
+	}
+	return report
+}
+
+func newEnvironmentReport() environmentReport {
+	hostname, _ := os.Hostname()
+	return environmentReport{
+		Hostname:   hostname,
+		GoVersion:  runtime.Version(),
+		GOOS:       runtime.GOOS,
+		GOARCH:     runtime.GOARCH,
+		NumCPU:     runtime.NumCPU(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		SearchURL:  searchURL,
+	}
+}
+
+func newStatsReport(s *costStats) statsReport {
+	errors := make(map[string]errorReport)
+	for class, c := range s.errors {
+		errors[class] = errorReport{
+			Count:   c.Count,
+			Ratio:   ratio(c.Count, s.total),
+			Samples: c.Samples,
+		}
+	}
+	byOutcome := make(map[string]outcomeReport)
+	for outcome, h := range s.byOutcome {
+		byOutcome[outcome] = outcomeReport{
+			Ratio:         ratio(int(h.TotalCount()), s.total+s.canceled),
+			latencyReport: newLatencyReport(h),
+		}
+	}
+	return statsReport{
+		Total:        s.total,
+		Canceled:     s.canceled,
+		Failed:       s.failed,
+		ErrorRatio:   s.errorRatio(),
+		SuccessCount: s.successCount,
+		SuccessRatio: ratio(s.successCount, s.total),
+		TimeOut:      s.timeOut,
+		TimeOutRatio: ratio(s.timeOut, s.total),
+		All:          newLatencyReport(s.all),
+		Success:      newLatencyReport(s.success),
+		Errors:       errors,
+		Outcomes:     byOutcome,
+	}
+}
+
+func newLatencyReport(h *hdrhistogram.Histogram) latencyReport {
+	report := latencyReport{
+		Count:       h.TotalCount(),
+		Mean:        h.Mean() / usPerSecond,
+		Min:         costSeconds(h.Min()),
+		Max:         costSeconds(h.Max()),
+		Percentiles: make(map[string]float64),
+	}
+	for _, q := range reportQuantiles {
+		report.Percentiles[percentileName(q)] = costSeconds(h.ValueAtQuantile(q))
+	}
+	return report
+}
+
+func percentileName(q float64) string {
+	return fmt.Sprintf("p%g", q)
+}
+
+// ratio 返回 n/total 的百分比
+func ratio(n int, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total) * 100
+}
+
+func (r *runReport) write(fileName string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileName, data, 0644)
+}
+
+func loadRunReport(fileName string) (*runReport, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var report runReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
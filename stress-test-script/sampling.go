@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// 词表的取样方式
+const (
+	// uniformSampling 每个值的概率一样
+	uniformSampling = "uniform"
+	// weightedSampling 按 csv 里的频次列加权，模拟热门的投资人、行业
+	weightedSampling = "weighted"
+	// zipfSampling 第 i 个值（从 1 开始）的权重是 1/i^exponent，exponent 越大越集中在前面的值
+	zipfSampling = "zipf"
+)
+
+// sampler 从 size() 个值里不放回地取 count 个下标，count 超过可取的个数时返回全部
+// sampler 本身不保存随机数状态，可以被多个 goroutine 共用
+type sampler interface {
+	sample(rng *rand.Rand, count int) []int
+	size() int
+}
+
+// uniformSampler 均匀不放回取样，每个下标被取到的概率一样
+type uniformSampler struct {
+	n int
+}
+
+func newUniformSampler(n int) *uniformSampler {
+	return &uniformSampler{n: n}
+}
+
+func (s *uniformSampler) size() int {
+	return s.n
+}
+
+// sample Floyd 算法，只需要 count 次随机，和 n 的大小无关
+func (s *uniformSampler) sample(rng *rand.Rand, count int) []int {
+	if count > s.n {
+		count = s.n
+	}
+	chosen := make(map[int]bool, count)
+	result := make([]int, 0, count)
+	for j := s.n - count; j < s.n; j++ {
+		t := rng.Intn(j + 1)
+		if chosen[t] {
+			t = j
+		}
+		chosen[t] = true
+		result = append(result, t)
+	}
+	// Floyd 算法取到的集合是均匀的，但顺序不是
+	rng.Shuffle(len(result), func(i, j int) { result[i], result[j] = result[j], result[i] })
+	return result
+}
+
+// weightedSampler 按权重不放回取样，取到重复的下标就重取
+type weightedSampler struct {
+	// cumulative[i] 是前 i+1 个权重的和
+	cumulative []float64
+	// positive 权重大于 0 的个数，最多只能取这么多个
+	positive int
+}
+
+func newWeightedSampler(weights []float64) (*weightedSampler, error) {
+	s := &weightedSampler{cumulative: make([]float64, len(weights))}
+	total := 0.0
+	for i, w := range weights {
+		if w < 0 || math.IsNaN(w) || math.IsInf(w, 0) {
+			return nil, fmt.Errorf("bad weight %g at %d", w, i)
+		}
+		if w > 0 {
+			s.positive++
+		}
+		total += w
+		s.cumulative[i] = total
+	}
+	return s, nil
+}
+
+// newZipfSampler 越靠前的值越热门，exponent 可以小于 1（math/rand 的 Zipf 要求大于 1）
+func newZipfSampler(n int, exponent float64) *weightedSampler {
+	weights := make([]float64, n)
+	for i := range weights {
+		weights[i] = 1 / math.Pow(float64(i+1), exponent)
+	}
+	s, _ := newWeightedSampler(weights)
+	return s
+}
+
+func (s *weightedSampler) size() int {
+	return len(s.cumulative)
+}
+
+func (s *weightedSampler) sample(rng *rand.Rand, count int) []int {
+	if count > s.positive {
+		count = s.positive
+	}
+	result := make([]int, 0, count)
+	if count <= 0 {
+		return result
+	}
+	total := s.cumulative[len(s.cumulative)-1]
+	chosen := make(map[int]bool, count)
+	// 权重很集中时重取的次数会很多，超过次数后用 fill 补齐
+	for tries := 0; len(result) < count && tries < 20*count+100; tries++ {
+		i := sort.SearchFloat64s(s.cumulative, rng.Float64()*total)
+		// rng.Float64()*total 刚好等于某个 cumulative 时会落在权重为 0 的值上
+		for i < len(s.cumulative)-1 && (s.cumulative[i] == 0 || (i > 0 && s.cumulative[i] == s.cumulative[i-1])) {
+			i++
+		}
+		if chosen[i] {
+			continue
+		}
+		chosen[i] = true
+		result = append(result, i)
+	}
+	if len(result) < count {
+		result = s.fill(rng, result, chosen, count)
+	}
+	return result
+}
+
+// fill 用 Efraimidis-Spirakis 算法从还没取到的值里按权重补齐 count 个，
+// 每个值的 key 是 u^(1/w)，取 key 最大的几个，需要遍历所有值
+func (s *weightedSampler) fill(rng *rand.Rand, result []int, chosen map[int]bool, count int) []int {
+	type keyed struct {
+		index int
+		key   float64
+	}
+	candidates := make([]keyed, 0)
+	previous := 0.0
+	for i, c := range s.cumulative {
+		w := c - previous
+		previous = c
+		if w <= 0 || chosen[i] {
+			continue
+		}
+		candidates = append(candidates, keyed{index: i, key: math.Pow(rng.Float64(), 1/w)})
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].key > candidates[j].key })
+	for _, c := range candidates {
+		if len(result) >= count {
+			break
+		}
+		result = append(result, c.index)
+	}
+	return result
+}
+
+// newSampler 按取样方式创建 sampler，weights 只有 weighted 用
+func newSampler(sampling string, n int, weights []float64, exponent float64) (sampler, error) {
+	switch sampling {
+	case "", uniformSampling:
+		return newUniformSampler(n), nil
+	case weightedSampling:
+		return newWeightedSampler(weights)
+	case zipfSampling:
+		if exponent <= 0 {
+			return nil, fmt.Errorf("zipf exponent should be positive, got %g", exponent)
+		}
+		return newZipfSampler(n, exponent), nil
+	default:
+		return nil, fmt.Errorf("unknown sampling %q", sampling)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestSamplers(t *testing.T) {
+	weighted, err := newSampler(weightedSampling, 5, []float64{0, 10, 0, 1, 1}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zipf, err := newSampler(zipfSampling, 100, nil, 1.2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		sampler sampler
+		count   int
+		want    int
+	}{
+		{"uniform", newUniformSampler(10), 3, 3},
+		{"uniform all", newUniformSampler(10), 20, 10},
+		{"uniform empty", newUniformSampler(0), 3, 0},
+		// 权重为 0 的值取不到
+		{"weighted", weighted, 2, 2},
+		{"weighted positive only", weighted, 5, 3},
+		{"zipf", zipf, 50, 50},
+	}
+	rng := rand.New(rand.NewSource(1))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				got := tt.sampler.sample(rng, tt.count)
+				if len(got) != tt.want {
+					t.Fatalf("sample(%d) got %d values, want %d", tt.count, len(got), tt.want)
+				}
+				seen := make(map[int]bool)
+				for _, index := range got {
+					if index < 0 || index >= tt.sampler.size() || seen[index] {
+						t.Fatalf("sample(%d) = %v, want distinct indexes in [0, %d)", tt.count, got, tt.sampler.size())
+					}
+					if tt.sampler == weighted && (index == 0 || index == 2) {
+						t.Fatalf("sample(%d) = %v, got an index with weight 0", tt.count, got)
+					}
+					seen[index] = true
+				}
+			}
+		})
+	}
+}
+
+func TestNewSamplerErrors(t *testing.T) {
+	tests := []struct {
+		sampling string
+		weights  []float64
+		exponent float64
+	}{
+		{"weighted", []float64{1, -1}, 0},
+		{"zipf", nil, 0},
+		{"random", nil, 0},
+	}
+	for _, tt := range tests {
+		if _, err := newSampler(tt.sampling, 2, tt.weights, tt.exponent); err == nil {
+			t.Errorf("newSampler(%s, %v, %g) error = nil, want an error", tt.sampling, tt.weights, tt.exponent)
+		}
+	}
+}
+
+// zipf 的第一个值应该比最后一个值更容易取到
+func TestZipfSkew(t *testing.T) {
+	s := newZipfSampler(100, 1.2)
+	rng := rand.New(rand.NewSource(1))
+	counts := make([]int, 100)
+	for i := 0; i < 10000; i++ {
+		counts[s.sample(rng, 1)[0]]++
+	}
+	if counts[0] <= counts[99]*10 {
+		t.Errorf("counts of first and last = %d, %d, want the first much more", counts[0], counts[99])
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 压测计划文件，每行一个阶段，# 开头为注释：
+//
+//	ramp  20 200 60s     60s 内 qps 从 20 线性增加到 200
+//	hold  200 120s       保持 200 qps 120s
+//	step  20 200 20 30s  从 20 开始每 30s 增加 20，直到 200
+//	spike 500 10s        突发 500 qps 10s
+//
+// 时长按秒取整，不足 1s 按 1s 算
+const (
+	rampPhase  = "ramp"
+	holdPhase  = "hold"
+	stepPhase  = "step"
+	spikePhase = "spike"
+)
+
+type phase struct {
+	Name         string
+	Kind         string
+	From         int
+	To           int
+	Step         int
+	StepDuration time.Duration
+	Duration     time.Duration
+}
+
+// qpsAt 返回阶段开始 elapsed 之后这一秒的 qps
+func (p phase) qpsAt(elapsed time.Duration) int {
+	switch p.Kind {
+	case rampPhase:
+		// 最后一秒达到 To
+		last := p.seconds() - 1
+		if last <= 0 {
+			return p.To
+		}
+		return p.From + (p.To-p.From)*int(elapsed/time.Second)/last
+	case stepPhase:
+		qps := p.From + p.Step*int(elapsed/p.StepDuration)
+		if qps > p.To {
+			return p.To
+		}
+		return qps
+	default:
+		return p.From
+	}
+}
+
+func (p phase) seconds() int {
+	return int(p.Duration / time.Second)
+}
+
+// requests 返回这个阶段计划发送的请求数
+func (p phase) requests() int {
+	var count int
+	for s := 0; s < p.seconds(); s++ {
+		count += p.qpsAt(time.Duration(s) * time.Second)
+	}
+	return count
+}
+
+// constantPhases 没有计划文件时按 -q -m 压测
+func constantPhases(qps int, seconds int) []phase {
+	return []phase{{
+		Name:     holdPhase,
+		Kind:     holdPhase,
+		From:     qps,
+		To:       qps,
+		Duration: time.Duration(seconds) * time.Second,
+	}}
+}
+
+func loadPhases(fileName string) ([]phase, error) {
+	lines, err := readFileLines(fileName, 0)
+	if err != nil {
+		return nil, err
+	}
+	phases := make([]phase, 0)
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p, err := parsePhase(strings.Fields(line))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", fileName, i+1, err)
+		}
+		p.Name = fmt.Sprintf("%d-%s", len(phases)+1, p.Kind)
+		phases = append(phases, p)
+	}
+	if len(phases) == 0 {
+		return nil, fmt.Errorf("%s: no phase", fileName)
+	}
+	return phases, nil
+}
+
+func parsePhase(fields []string) (phase, error) {
+	p := phase{Kind: fields[0]}
+	args := fields[1:]
+	var want int
+	switch p.Kind {
+	case rampPhase:
+		want = 3
+	case holdPhase, spikePhase:
+		want = 2
+	case stepPhase:
+		want = 4
+	default:
+		return p, fmt.Errorf("unknown phase %q", p.Kind)
+	}
+	if len(args) != want {
+		return p, fmt.Errorf("%s needs %d arguments, got %d", p.Kind, want, len(args))
+	}
+	var qpsArgs = make([]int, 0)
+	for _, arg := range args[:len(args)-1] {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 0 {
+			return p, fmt.Errorf("invalid qps %q", arg)
+		}
+		qpsArgs = append(qpsArgs, n)
+	}
+	d, err := time.ParseDuration(args[len(args)-1])
+	if err != nil {
+		return p, err
+	}
+	d = d.Round(time.Second)
+	if d < time.Second {
+		d = time.Second
+	}
+
+	p.From = qpsArgs[0]
+	p.To = qpsArgs[0]
+	p.Duration = d
+	switch p.Kind {
+	case rampPhase:
+		p.To = qpsArgs[1]
+	case stepPhase:
+		p.To = qpsArgs[1]
+		p.Step = qpsArgs[2]
+		p.StepDuration = d
+		if p.Step <= 0 || p.To < p.From {
+			return p, fmt.Errorf("step needs from <= to and a positive increment")
+		}
+		p.Duration = time.Duration((p.To-p.From)/p.Step+1) * d
+	}
+	return p, nil
+}
+
+func phasesDuration(phases []phase) time.Duration {
+	var d time.Duration
+	for _, p := range phases {
+		d += p.Duration
+	}
+	return d
+}
+
+func phasesRequests(phases []phase) int {
+	var count int
+	for _, p := range phases {
+		count += p.requests()
+	}
+	return count
+}
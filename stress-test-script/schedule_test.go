@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePhase(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    phase
+		wantErr bool
+	}{
+		{line: "ramp 20 200 60s", want: phase{Kind: rampPhase, From: 20, To: 200, Duration: 60 * time.Second}},
+		{line: "hold 200 120s", want: phase{Kind: holdPhase, From: 200, To: 200, Duration: 120 * time.Second}},
+		{line: "spike 500 10s", want: phase{Kind: spikePhase, From: 500, To: 500, Duration: 10 * time.Second}},
+		// 20, 40, ..., 200 一共 10 步
+		{line: "step 20 200 20 30s", want: phase{Kind: stepPhase, From: 20, To: 200, Step: 20, StepDuration: 30 * time.Second, Duration: 300 * time.Second}},
+		// 不足 1s 按 1s 算
+		{line: "hold 100 300ms", want: phase{Kind: holdPhase, From: 100, To: 100, Duration: time.Second}},
+		{line: "hold 100 1500ms", want: phase{Kind: holdPhase, From: 100, To: 100, Duration: 2 * time.Second}},
+		{line: "burst 100 10s", wantErr: true},
+		{line: "ramp 20 60s", wantErr: true},
+		{line: "hold 100 200 10s", wantErr: true},
+		{line: "hold x 10s", wantErr: true},
+		{line: "hold -1 10s", wantErr: true},
+		{line: "hold 100 10", wantErr: true},
+		{line: "step 200 20 20 30s", wantErr: true},
+		{line: "step 20 200 0 30s", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, err := parsePhase(strings.Fields(tt.line))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePhase() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parsePhase() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPhaseQPSAt(t *testing.T) {
+	ramp := phase{Kind: rampPhase, From: 0, To: 100, Duration: 11 * time.Second}
+	step := phase{Kind: stepPhase, From: 20, To: 200, Step: 20, StepDuration: 30 * time.Second, Duration: 300 * time.Second}
+	tests := []struct {
+		name    string
+		phase   phase
+		elapsed time.Duration
+		want    int
+	}{
+		{"ramp start", ramp, 0, 0},
+		{"ramp middle", ramp, 5 * time.Second, 50},
+		// 不满一秒按这一秒开始算
+		{"ramp middle of a second", ramp, 5500 * time.Millisecond, 50},
+		{"ramp last second", ramp, 10 * time.Second, 100},
+		{"ramp down", phase{Kind: rampPhase, From: 100, To: 0, Duration: 11 * time.Second}, 3 * time.Second, 70},
+		{"ramp of one second", phase{Kind: rampPhase, From: 10, To: 50, Duration: time.Second}, 0, 50},
+		{"step first", step, 29 * time.Second, 20},
+		{"step second", step, 30 * time.Second, 40},
+		{"step last", step, 299 * time.Second, 200},
+		{"step after end", step, 400 * time.Second, 200},
+		{"hold", phase{Kind: holdPhase, From: 80, To: 80, Duration: 10 * time.Second}, 7 * time.Second, 80},
+		{"spike", phase{Kind: spikePhase, From: 500, To: 500, Duration: 10 * time.Second}, 0, 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.phase.qpsAt(tt.elapsed); got != tt.want {
+				t.Errorf("qpsAt(%s) = %d, want %d", tt.elapsed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPhaseRequests(t *testing.T) {
+	tests := []struct {
+		phase phase
+		want  int
+	}{
+		// 0 + 10 + ... + 100
+		{phase{Kind: rampPhase, From: 0, To: 100, Duration: 11 * time.Second}, 550},
+		{phase{Kind: stepPhase, From: 10, To: 30, Step: 10, StepDuration: 2 * time.Second, Duration: 6 * time.Second}, 120},
+		{constantPhases(50, 60)[0], 3000},
+	}
+	for _, tt := range tests {
+		if got := tt.phase.requests(); got != tt.want {
+			t.Errorf("%+v requests() = %d, want %d", tt.phase, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pb "gitlab.com/momentum-valley/advanced-search/rpc/advanced-search"
+)
+
+const (
+	uniformArrival = "uniform"
+	poissonArrival = "poisson"
+
+	closedLoopPhase = "closed-loop"
+)
+
+var drainTimeout = flag.Duration("drain", 30*time.Second, "max time to wait for in-flight requests after sending stops")
+
+// inFlight 记录还没返回的请求
+var inFlight sync.WaitGroup
+
+// counters 当前这次压测的请求数
+var counters *loadCounters
+
+// loadCounters sent: 已发出，completed: 已返回，abandoned: drain 超时或 Ctrl-C 时被取消
+type loadCounters struct {
+	sent, completed, abandoned int64
+}
+
+func (c *loadCounters) inFlight() int64 {
+	return atomic.LoadInt64(&c.sent) - atomic.LoadInt64(&c.completed) - atomic.LoadInt64(&c.abandoned)
+}
+
+// done 请求返回时调用，被压测的 ctx 取消的请求不算 completed，
+// 请求自己的 -deadline 超时是 DeadlineExceeded，还是算 completed
+func (c *loadCounters) done(ctx context.Context, err error) {
+	if err != nil && ctx.Err() == context.Canceled {
+		atomic.AddInt64(&c.abandoned, 1)
+		return
+	}
+	atomic.AddInt64(&c.completed, 1)
+}
+
+// runLoad 按 -concurrency 或 phases 执行一次压测，边跑边统计结果
+func runLoad(ctx context.Context, client pb.AdvancedSearch, w *workload, phases []phase) *runStats {
+	return runWith(ctx, phasesDuration(phases), func(sendCtx context.Context, queryCtx context.Context) {
+		if *concurrency > 0 {
+			runClosedLoop(sendCtx, queryCtx, client, w)
+		} else {
+			// 每秒发 qps 个请求，发送时间分散在这一秒内
+			runOpenLoop(sendCtx, queryCtx, client, w, phases)
+		}
+	})
+}
+
+// runWith 用 send 发请求，边跑边统计结果
+// send 返回或者超过 sendTimeout（0 表示不限制）后停止发送，
+// 等还没返回的请求最多 -drain，超时的请求会被取消；
+// ctx 被取消（Ctrl-C）时立即停止发送并取消所有请求
+func runWith(ctx context.Context, sendTimeout time.Duration, send func(sendCtx context.Context, queryCtx context.Context)) *runStats {
+	queryCtx, cancelQueries := context.WithCancel(ctx)
+	defer cancelQueries()
+	sendCtx, stopSending := context.WithCancel(queryCtx)
+	if sendTimeout > 0 {
+		sendCtx, stopSending = context.WithTimeout(queryCtx, sendTimeout)
+	}
+	defer stopSending()
+
+	counters = &loadCounters{}
+	// 边跑边统计，内存占用和压测时长无关
+	resChan = make(chan testResult, resultBuffer)
+	statsChan := make(chan *runStats)
+	go func() {
+		statsChan <- calculate()
+	}()
+
+	send(sendCtx, queryCtx)
+	stopSending()
+
+	drained := make(chan struct{})
+	go func() {
+		inFlight.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(*drainTimeout):
+		log.Printf("drain timeout, abandon %d in-flight requests", counters.inFlight())
+		cancelQueries()
+		<-drained
+	}
+	close(resChan)
+
+	stats := <-statsChan
+	stats.sent = counters.sent
+	stats.completed = counters.completed
+	stats.abandoned = counters.abandoned
+	return stats
+}
+
+// openLoopSlot 下一个 open-loop 请求的编号，多次压测（find-capacity 的 trial）接着编号，
+// 这样每次 trial 的请求序列都不一样，后面的 trial 不会因为命中前面 trial 的缓存而显得更快
+var openLoopSlot uint64
+
+// runOpenLoop 按计划时间发请求，不等待上一个请求返回（open-loop）
+// 每个请求都有一个计划发送时间，延时从计划时间开始算，
+// 这样服务端变慢导致的排队时间也会算进延时里，避免 coordinated omission
+// 按 phases 依次执行，每秒的 qps 由所在阶段决定
+// sendCtx 结束时停止发送，queryCtx 用于请求本身
+func runOpenLoop(sendCtx context.Context, queryCtx context.Context, client pb.AdvancedSearch, w *workload, phases []phase) {
+	secondStart := time.Now()
+	scheduleRand := slotRand(scheduleStream, openLoopSlot)
+	for _, p := range phases {
+		log.Printf("phase %s: %d -> %d qps in %s", p.Name, p.From, p.To, p.Duration)
+		for s := 0; s < p.seconds(); s++ {
+			for _, offset := range arrivalOffsets(scheduleRand, p.qpsAt(time.Duration(s)*time.Second)) {
+				intended := secondStart.Add(offset)
+				if !sleepUntil(sendCtx, intended) {
+					return
+				}
+				inFlight.Add(1)
+				go func(intended time.Time, phaseName string, slot uint64) {
+					defer inFlight.Done()
+					makeQuery(queryCtx, client, w, slotRand(openLoopStream, slot), intended, phaseName)
+				}(intended, p.Name, openLoopSlot)
+				openLoopSlot++
+			}
+			secondStart = secondStart.Add(time.Second)
+		}
+	}
+}
+
+// runClosedLoop 固定 concurrency 个虚拟用户，每个用户等上一个请求返回，
+// 再等 think time 后发下一个（closed-loop），服务变慢时并发数也不会增长
+// sendCtx 结束后返回，虚拟用户手上的请求由 runLoad 等待
+func runClosedLoop(sendCtx context.Context, queryCtx context.Context, client pb.AdvancedSearch, w *workload) {
+	for i := 0; i < *concurrency; i++ {
+		inFlight.Add(1)
+		go func(user uint64) {
+			defer inFlight.Done()
+			for n := uint64(0); sendCtx.Err() == nil; n++ {
+				makeQuery(queryCtx, client, w, slotRand(closedLoopStream, user<<32|n), time.Now(), closedLoopPhase)
+				if !sleepUntil(sendCtx, time.Now().Add(*thinkTime)) {
+					return
+				}
+			}
+		}(uint64(i))
+	}
+	<-sendCtx.Done()
+}
+
+// sleepUntil 等到 t，ctx 被取消时返回 false
+func sleepUntil(ctx context.Context, t time.Time) bool {
+	wait := time.Until(t)
+	if wait <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// arrivalOffsets 返回一秒内 n 个请求相对于这一秒开始的发送时间
+// uniform: 均匀间隔
+// poisson: 已知一秒内到达 n 个时，泊松过程的到达时间等价于 n 个均匀随机点排序
+func arrivalOffsets(rng *rand.Rand, n int) []time.Duration {
+	offsets := make([]time.Duration, n)
+	if n <= 0 {
+		return offsets
+	}
+	switch *arrival {
+	case poissonArrival:
+		for i := range offsets {
+			offsets[i] = time.Duration(rng.Int63n(int64(time.Second)))
+		}
+		sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	default:
+		for i := range offsets {
+			offsets[i] = time.Second * time.Duration(i) / time.Duration(n)
+		}
+	}
+	return offsets
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	pb "gitlab.com/momentum-valley/advanced-search/rpc/advanced-search"
+)
+
+// blockingClient Search 的 SearchType 为 NONE 时一直等到 ctx 被取消，其他立即返回
+type blockingClient struct {
+	pb.AdvancedSearch
+}
+
+func (blockingClient) Search(ctx context.Context, req *pb.SearchRequest) (*pb.SearchResponse, error) {
+	if req.SearchType == pb.SearchType_NONE {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return &pb.SearchResponse{}, nil
+}
+
+func TestRunWithAbandoned(t *testing.T) {
+	defer func(d time.Duration) { *drainTimeout = d }(*drainTimeout)
+	*drainTimeout = 50 * time.Millisecond
+
+	tests := []struct {
+		name                 string
+		fast, slow           int
+		deadline             time.Duration
+		interrupt            bool
+		completed, abandoned int64
+	}{
+		{name: "all returned", fast: 10, completed: 10},
+		{name: "slow requests abandoned", fast: 3, slow: 2, completed: 3, abandoned: 2},
+		// 超过 resChan 缓冲区的结果也不能算作 abandoned
+		{name: "buffered results", fast: resultBuffer + 500, slow: 1, completed: resultBuffer + 500, abandoned: 1},
+		// 自己超时的请求是 completed
+		{name: "request deadline", slow: 3, deadline: 10 * time.Millisecond, completed: 3},
+		// Ctrl-C 时被取消的请求
+		{name: "interrupted", fast: 3, slow: 2, interrupt: true, completed: 3, abandoned: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(d time.Duration) { *requestDeadline = d }(*requestDeadline)
+			*requestDeadline = tt.deadline
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.interrupt {
+				// 在 drain 超时之前取消
+				time.AfterFunc(10*time.Millisecond, cancel)
+			}
+			client := blockingClient{}
+			stats := runWith(ctx, 0, func(sendCtx context.Context, queryCtx context.Context) {
+				var wg sync.WaitGroup
+				for i := 0; i < tt.fast+tt.slow; i++ {
+					searchType := pb.SearchType_COMPANY
+					if i < tt.slow {
+						searchType = pb.SearchType_NONE
+					}
+					inFlight.Add(1)
+					wg.Add(1)
+					go func(req *pb.SearchRequest) {
+						defer inFlight.Done()
+						wg.Done()
+						sendQuery(queryCtx, client, req, time.Now(), "test", 1)
+					}(&pb.SearchRequest{SearchType: searchType})
+				}
+				wg.Wait()
+			})
+			if stats.sent != int64(tt.fast+tt.slow) || stats.completed != tt.completed || stats.abandoned != tt.abandoned {
+				t.Errorf("sent=%d completed=%d abandoned=%d, want %d %d %d",
+					stats.sent, stats.completed, stats.abandoned, tt.fast+tt.slow, tt.completed, tt.abandoned)
+			}
+			if stats.sent != stats.completed+stats.abandoned {
+				t.Errorf("sent=%d != completed=%d + abandoned=%d", stats.sent, stats.completed, stats.abandoned)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"hash/fnv"
+	"math/rand"
+	"time"
+)
+
+var seed = flag.Int64("seed", 0, "seed of all random choices, 0 means a random seed; the seed is logged and saved in the report")
+
+// 随机数流，不同用途的随机数互不影响
+const (
+	// openLoopStream 按计划发送顺序编号的请求，见 openLoopSlot
+	openLoopStream uint64 = iota + 1
+	// closedLoopStream 虚拟用户编号 << 32 | 第几个请求
+	closedLoopStream
+	// scheduleStream poisson 到达时间
+	scheduleStream
+	// vocabularyStream 启动时的词表取样，按词表名区分
+	vocabularyStream
+)
+
+// resolveSeed -seed 为 0 时用当前时间，之后 *seed 就是这次压测真正用的 seed
+func resolveSeed() {
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+}
+
+// slotRand 返回第 slot 个请求专用的随机数，只由 seed、stream 和 slot 决定，
+// 所以同一个 seed 生成的请求序列一样，和 goroutine 的调度无关，
+// 每个请求一个 rand.Rand 也避免了全局 rand 的锁竞争
+func slotRand(stream uint64, slot uint64) *rand.Rand {
+	return rand.New(rand.NewSource(int64(mix64(mix64(uint64(*seed)^mix64(stream)) ^ slot))))
+}
+
+// nameSlot 把名字转成 slot
+func nameSlot(name string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return h.Sum64()
+}
+
+// mix64 splitmix64 的混合函数，相邻的输入得到差别很大的输出
+func mix64(z uint64) uint64 {
+	z += 0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
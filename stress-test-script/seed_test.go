@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	pb "gitlab.com/momentum-valley/advanced-search/rpc/advanced-search"
+)
+
+// recordingClient 记下收到的请求，立即返回空结果
+type recordingClient struct {
+	pb.AdvancedSearch
+	mu       sync.Mutex
+	requests []string
+}
+
+func (c *recordingClient) Search(ctx context.Context, req *pb.SearchRequest) (*pb.SearchResponse, error) {
+	conditions := make([]string, 0)
+	for _, condition := range req.Conditions {
+		conditions = append(conditions, fmt.Sprintf("%s%s%v", condition.Id, condition.Operator, condition.Values))
+	}
+	sort.Strings(conditions)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = append(c.requests, strings.Join(conditions, ";"))
+	return &pb.SearchResponse{}, nil
+}
+
+func (c *recordingClient) take() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	requests := c.requests
+	c.requests = nil
+	sort.Strings(requests)
+	return requests
+}
+
+func TestOpenLoopSlotAcrossRuns(t *testing.T) {
+	defer func(s int64, slot uint64) { *seed, openLoopSlot = s, slot }(*seed, openLoopSlot)
+	w, err := loadWorkload("workload.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &recordingClient{}
+	run := func() []string {
+		runLoad(context.Background(), client, w, constantPhases(20, 1))
+		return client.take()
+	}
+
+	*seed, openLoopSlot = 42, 0
+	first := run()
+	second := run()
+	if len(first) != 20 || len(second) != 20 {
+		t.Fatalf("got %d and %d requests, want 20", len(first), len(second))
+	}
+	// find-capacity 的第二次 trial 不能重复第一次的请求
+	if strings.Join(first, "\n") == strings.Join(second, "\n") {
+		t.Errorf("second run repeats the requests of the first run")
+	}
+
+	// 同一个 seed 从头开始时请求一样
+	openLoopSlot = 0
+	if again := run(); strings.Join(again, "\n") != strings.Join(first, "\n") {
+		t.Errorf("same seed and slot give different requests")
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// 延时直方图记录 1us 到 1h，精度 3 位有效数字，单位 us
+const (
+	minTrackableCost = 1
+	maxTrackableCost = int64(time.Hour / time.Microsecond)
+	costSigFigs      = 3
+
+	usPerSecond = float64(time.Second / time.Microsecond)
+)
+
+var reportQuantiles = []float64{50, 90, 95, 99, 99.9}
+
+// 每个请求的结果归为一类，分别统计延时
+// canceled: drain 超时或 Ctrl-C 时被取消，timeout: 超过 -deadline，
+// error: 其他错误，empty: 没有结果，partial: 结果不足一页（-p），full: 满一页
+const (
+	outcomeCanceled = "canceled"
+	outcomeTimeout  = "timeout"
+	outcomeError    = "error"
+	outcomeEmpty    = "empty"
+	outcomePartial  = "partial"
+	outcomeFull     = "full"
+)
+
+var outcomes = []string{outcomeCanceled, outcomeTimeout, outcomeError, outcomeEmpty, outcomePartial, outcomeFull}
+
+func (res testResult) outcome() string {
+	if res.Err != nil {
+		switch classifyError(res.Err) {
+		case errorCanceled:
+			return outcomeCanceled
+		case errorDeadline:
+			return outcomeTimeout
+		}
+	}
+	switch {
+	case res.Err != nil:
+		return outcomeError
+	case res.Count == 0:
+		return outcomeEmpty
+	case res.Count < *pageSize:
+		return outcomePartial
+	default:
+		return outcomeFull
+	}
+}
+
+type runStats struct {
+	all     *costStats
+	byPhase map[string]*costStats
+	// 翻页时每一页的统计，见 -pages
+	byPage map[int]*costStats
+	// 第一个排序列 => 统计
+	bySort map[string]*costStats
+
+	sent, completed, abandoned int64
+}
+
+func (r *runStats) add(res testResult) {
+	r.all.add(res)
+	addGrouped(r.byPhase, res.Phase, res)
+	addGrouped(r.bySort, res.Sort, res)
+	stats, ok := r.byPage[res.Page]
+	if !ok {
+		stats = newCostStats()
+		r.byPage[res.Page] = stats
+	}
+	stats.add(res)
+}
+
+// merge 合并另一次压测（或另一个阶段）的统计
+func (r *runStats) merge(other *runStats) {
+	r.sent += other.sent
+	r.completed += other.completed
+	r.abandoned += other.abandoned
+	r.all.merge(other.all)
+	mergeGrouped(r.byPhase, other.byPhase)
+	mergeGrouped(r.bySort, other.bySort)
+	for page, stats := range other.byPage {
+		if mine, ok := r.byPage[page]; ok {
+			mine.merge(stats)
+		} else {
+			r.byPage[page] = newCostStats().merge(stats)
+		}
+	}
+}
+
+func (r *runStats) print() {
+	log.Printf("sent=%d, completed=%d, abandoned=%d", r.sent, r.completed, r.abandoned)
+	r.all.print("")
+
+	// 只有一个阶段时和上面的结果一样
+	if len(r.byPhase) > 1 {
+		for _, p := range phases {
+			if stats, ok := r.byPhase[p.Name]; ok {
+				stats.print("[" + p.Name + "] ")
+			}
+		}
+	}
+	if len(r.byPage) > 1 {
+		for _, page := range r.pages() {
+			r.byPage[page].print(fmt.Sprintf("[page %d] ", page))
+		}
+	}
+	if len(r.bySort) > 1 {
+		for _, column := range sortedKeys(r.bySort) {
+			r.bySort[column].print("[sort " + column + "] ")
+		}
+	}
+}
+
+func addGrouped(groups map[string]*costStats, key string, res testResult) {
+	stats, ok := groups[key]
+	if !ok {
+		stats = newCostStats()
+		groups[key] = stats
+	}
+	stats.add(res)
+}
+
+func mergeGrouped(groups map[string]*costStats, other map[string]*costStats) {
+	for key, stats := range other {
+		if mine, ok := groups[key]; ok {
+			mine.merge(stats)
+		} else {
+			groups[key] = newCostStats().merge(stats)
+		}
+	}
+}
+
+func sortedKeys(groups map[string]*costStats) []string {
+	keys := make([]string, 0)
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// pages 返回有统计的页码，从小到大
+func (r *runStats) pages() []int {
+	pages := make([]int, 0)
+	for page := range r.byPage {
+		pages = append(pages, page)
+	}
+	sort.Ints(pages)
+	return pages
+}
+
+// costStats 一组请求的统计，all 为全部没出错的请求，success 为有结果（Count != 0）的请求
+type costStats struct {
+	total, failed, timeOut, successCount, successTimeOut int
+	// 被取消的请求，不算在 total 里
+	canceled int
+
+	all     *hdrhistogram.Histogram
+	success *hdrhistogram.Histogram
+
+	// 错误分类 => 次数和错误信息
+	errors map[string]*errorClass
+	// outcome => 延时，包括出错的请求
+	byOutcome map[string]*hdrhistogram.Histogram
+}
+
+func newCostStats() *costStats {
+	s := &costStats{
+		all:       newCostHistogram(),
+		success:   newCostHistogram(),
+		errors:    make(map[string]*errorClass),
+		byOutcome: make(map[string]*hdrhistogram.Histogram),
+	}
+	for _, outcome := range outcomes {
+		s.byOutcome[outcome] = newCostHistogram()
+	}
+	return s
+}
+
+func newCostHistogram() *hdrhistogram.Histogram {
+	return hdrhistogram.New(minTrackableCost, maxTrackableCost, costSigFigs)
+}
+
+// recordCost 超出范围的延时按最大值记录
+func recordCost(h *hdrhistogram.Histogram, cost time.Duration) {
+	us := int64(cost / time.Microsecond)
+	if us < minTrackableCost {
+		us = minTrackableCost
+	}
+	if us > maxTrackableCost {
+		us = maxTrackableCost
+	}
+	h.RecordValue(us)
+}
+
+func costSeconds(us int64) float64 {
+	return float64(us) / usPerSecond
+}
+
+func (s *costStats) add(res testResult) {
+	outcome := res.outcome()
+	recordCost(s.byOutcome[outcome], res.Cost)
+	// 被取消的请求不知道真实延时，不计入其他统计
+	if outcome == outcomeCanceled {
+		s.canceled++
+		return
+	}
+	s.total++
+	// 超过 -deadline 的请求按延时统计，不算失败
+	if res.Err != nil && outcome != outcomeTimeout {
+		s.failed++
+		s.addError(classifyError(res.Err), 1, res.Err.Error())
+		return
+	}
+	isTimeOut := res.Cost.Seconds()*1000 > float64(*timeLimit)
+	if res.Count != 0 {
+		recordCost(s.success, res.Cost)
+		if isTimeOut {
+			s.successTimeOut++
+		}
+		s.successCount++
+	}
+	recordCost(s.all, res.Cost)
+	if isTimeOut {
+		s.timeOut++
+	}
+}
+
+func (s *costStats) addError(class string, count int, samples ...string) {
+	c, ok := s.errors[class]
+	if !ok {
+		c = &errorClass{}
+		s.errors[class] = c
+	}
+	c.add(count, samples...)
+}
+
+func (s *costStats) merge(other *costStats) *costStats {
+	s.canceled += other.canceled
+	s.total += other.total
+	s.failed += other.failed
+	s.timeOut += other.timeOut
+	s.successCount += other.successCount
+	s.successTimeOut += other.successTimeOut
+	s.all.Merge(other.all)
+	s.success.Merge(other.success)
+	for _, outcome := range outcomes {
+		s.byOutcome[outcome].Merge(other.byOutcome[outcome])
+	}
+	for class, c := range other.errors {
+		s.addError(class, c.Count, c.Samples...)
+	}
+	return s
+}
+
+// quantile 返回没出错的请求耗时的 q 分位数（0-100），单位秒
+func (s *costStats) quantile(q float64) float64 {
+	return costSeconds(s.all.ValueAtQuantile(q))
+}
+
+func (s *costStats) errorRatio() float64 {
+	if s.total == 0 {
+		return 0
+	}
+	return float64(s.failed) / float64(s.total) * 100
+}
+
+// print prefix 为空时前两行格式和以前一样，方便和注释里的历史数据对比
+func (s *costStats) print(prefix string) {
+	timeOutRatio := float64(s.timeOut) / float64(s.total) * 100
+	successRatio := float64(s.successCount) / float64(s.total) * 100
+	successTimeOutRatio := float64(s.successTimeOut) / float64(s.successCount) * 100
+	log.Printf("%savg=%.5fs, min=%.5fs, max=%.5fs, failed=%d, successCount=%d, successRatio=%.2f%%, timeOut=%d, timeOutRatio=%.2f%%\n",
+		prefix, s.all.Mean()/usPerSecond, costSeconds(s.all.Min()), costSeconds(s.all.Max()), s.failed, s.successCount, successRatio, s.timeOut, timeOutRatio)
+
+	log.Printf("%ssuccess: avg=%.5fs, min=%.5fs, max=%.5fs, timeOut=%d, timeOutRatio=%.2f%%",
+		prefix, s.success.Mean()/usPerSecond, costSeconds(s.success.Min()), costSeconds(s.success.Max()), s.successTimeOut, successTimeOutRatio)
+
+	log.Printf("%sall: %s", prefix, percentiles(s.all))
+	log.Printf("%ssuccess: %s", prefix, percentiles(s.success))
+	for _, outcome := range outcomes {
+		h := s.byOutcome[outcome]
+		log.Printf("%soutcome %s: count=%d, ratio=%.2f%%, %s",
+			prefix, outcome, h.TotalCount(), ratio(int(h.TotalCount()), s.total+s.canceled), percentiles(h))
+	}
+
+	classes := make([]string, 0)
+	for class := range s.errors {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	for _, class := range classes {
+		c := s.errors[class]
+		log.Printf("%serror %s: count=%d, ratio=%.2f%%, samples=%q", prefix, class, c.Count, ratio(c.Count, s.total), c.Samples)
+	}
+}
+
+func percentiles(h *hdrhistogram.Histogram) string {
+	fields := make([]string, 0)
+	for _, q := range reportQuantiles {
+		fields = append(fields, fmt.Sprintf("%s=%.5fs", percentileName(q), costSeconds(h.ValueAtQuantile(q))))
+	}
+	fields = append(fields, fmt.Sprintf("max=%.5fs", costSeconds(h.Max())))
+	return strings.Join(fields, ", ")
+}
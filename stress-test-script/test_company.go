@@ -10,8 +10,11 @@ import (
 	"math/rand"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/golang/protobuf/ptypes/wrappers"
@@ -21,16 +24,24 @@ import (
 
 var qps = flag.Int("q", 50, "qps")
 var pageSize = flag.Int("p", 50, "page size")
-var searchType = flag.Int("t", 1, "search type 0-6")
+var searchType = flag.Int("t", 1, "search type 1-6, see search_types of the workload file")
 var timeLimit = flag.Int("l", 500, "time limit(unit: ms)")
 var conditionCount = flag.Int("c", 5, "count of conditions")
 
 var seconds = flag.Int("m", 60, "seconds of benchmark test")
-
-var duration time.Duration
-var reqCount int
+var arrival = flag.String("a", uniformArrival, "arrival of requests in each second: uniform|poisson")
+var concurrency = flag.Int("concurrency", 0, "virtual users of closed-loop mode, 0 means qps mode")
+var thinkTime = flag.Duration("think", 0, "think time between two queries of a virtual user")
+var scheduleFile = flag.String("s", "", "schedule file of load phases, overrides -q and -m")
+var reportFile = flag.String("report", "", "write the json report of the run to this file")
+var requestDeadline = flag.Duration("deadline", time.Minute, "deadline of each request, 0 means no deadline")
+var pageDepth = flag.Int("pages", 1, "pages to walk for each query, following the cursor of the previous page")
+
+var phases []phase
 var resChan = make(chan testResult)
-var reqChan = make(chan pb.SearchRequest)
+
+// resChan 由 calculate 边跑边消费
+const resultBuffer = 1024
 
 var searchTypes = []pb.SearchType{
 	pb.SearchType_NONE,
@@ -46,65 +57,134 @@ type testResult struct {
 	Err   error
 	Cost  time.Duration
 	Count int
+	Phase string
+	// Page 第几页，从 1 开始
+	Page int
+	// Sort 全部排序列和方向，没有排序时为 none
+	Sort string
 }
 
 func main() {
 	flag.Parse()
+	switch flag.Arg(0) {
+	case "compare":
+		compareReports(flag.Arg(1), flag.Arg(2))
+		return
+	case "history":
+		historyCommand(flag.Args()[1:])
+		return
+	case "import":
+		importCommand(flag.Args()[1:])
+		return
+	case "record":
+		recordCommand(flag.Args()[1:])
+		return
+	}
+	resolveSeed()
+	log.Printf("seed=%d", *seed)
 	log.Printf("search type is %s", pb.SearchType_name[int32(*searchType)])
-	log.Printf("qps=%d", *qps)
+	if *concurrency > 0 {
+		log.Printf("concurrency=%d, think=%s", *concurrency, *thinkTime)
+	} else if *scheduleFile != "" {
+		log.Printf("schedule=%s", *scheduleFile)
+	} else {
+		log.Printf("qps=%d", *qps)
+	}
 	log.Printf("pageSize=%d", *pageSize)
 	log.Printf("timeLimit=%d ms", *timeLimit)
 	log.Printf("conditionCount=%d", *conditionCount)
-	log.Printf("test for %d seconds", *seconds)
+	log.Printf("arrival=%s", *arrival)
 
-	duration = time.Duration(*seconds) * time.Second
-	reqCount = int(duration/time.Second) * *qps
-	fmt.Println("===", reqCount)
-	resChan = make(chan testResult, reqCount)
-	reqChan = make(chan pb.SearchRequest, reqCount)
+	phases = constantPhases(*qps, *seconds)
+	if *scheduleFile != "" && *concurrency <= 0 {
+		var err error
+		phases, err = loadPhases(*scheduleFile)
+		if err != nil {
+			log.Printf("Cannot load schedule file: %s, err: [%v]", *scheduleFile, err)
+			return
+		}
+	}
+	planned := phasesRequests(phases)
+	log.Printf("test for %s", phasesDuration(phases))
+	if *concurrency <= 0 {
+		log.Printf("planned requests=%d", planned)
+	}
 	log.SetFlags(log.Lshortfile | log.LstdFlags)
 	// runtime.GOMAXPROCS(4) // 最多使用4个核
 
-	benchmarkTest()
-}
+	var err error
+	series, err = newSeriesRecorder(*seriesFile)
+	if err != nil {
+		log.Printf("Cannot create series file: %s, err: [%v]", *seriesFile, err)
+		return
+	}
+	go series.run(*seriesInterval)
+	defer series.close()
 
-func benchmarkTest() {
-	defer calculate()
-	defer printTimeOutReq()
-	client := pb.NewAdvancedSearchProtobufClient("http://localhost:8081", &http.Client{})
+	// 回放慢请求文件时不能覆盖它
+	if flag.Arg(0) == "replay" && sameFile(flag.Arg(1), *slowFile) {
+		*slowFile = ""
+	}
+	slowRequests, err = newRequestLogger(*slowFile)
+	if err != nil {
+		log.Printf("Cannot create slow request file: %s, err: [%v]", *slowFile, err)
+		return
+	}
+	defer slowRequests.close()
+
+	// Ctrl-C 时取消所有请求，输出已经完成的部分的结果
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+		<-interrupt
+		// 再按一次 Ctrl-C 直接退出
+		signal.Stop(interrupt)
+		log.Printf("interrupted, canceling in-flight requests")
+		cancel()
+	}()
+
+	switch flag.Arg(0) {
+	case "find-capacity":
+		findCapacity(ctx)
+	case "replay":
+		replayCommand(ctx, flag.Arg(1))
+	default:
+		benchmarkTest(ctx)
+	}
+}
 
-	investorLines, err := readFileLines(investorsFileName, 0)
-	verticalLines, err := readFileLines(verticalsFileName, 0)
-	industryLines, err := readFileLines(industriesFileName, 0)
+func benchmarkTest(ctx context.Context) {
+	client := pb.NewAdvancedSearchProtobufClient(searchURL, &http.Client{})
+	w, err := loadSearchWorkload()
 	if err != nil {
 		return
 	}
-	choicedIndustryLines := randChoice(0, industryLines, 0)
-	choicedVerticalLines := randChoice(0, verticalLines, 0)
-	choicedInvestorLines := randChoice(0, investorLines, 500)
-	industries := getVerticals(choicedIndustryLines)
-	verticals := getVerticals(choicedVerticalLines)
-	verticals = append(verticals, industries...)
-	investors := getInvestors(choicedInvestorLines)
-
-	// 定时一分钟
-	durationTimer := time.NewTimer(duration)
-
-	for {
-		// 每秒发 qps 个请求
-		secondTimer := time.NewTimer(1 * time.Second)
-		for i := 0; i < *qps; i++ {
-			go makeQuery(client, verticals, investors)
+	start := time.Now()
+	stats := runLoad(ctx, client, w, phases)
+	fmt.Println("done")
+	finishRun(stats, start, time.Now())
+}
+
+// finishRun 输出结果，保存报告
+func finishRun(stats *runStats, start time.Time, end time.Time) {
+	stats.print()
+	report := newRunReport(stats, start, end)
+	log.Printf("run id=%s", report.ID)
+	if *reportFile != "" {
+		if err := report.write(*reportFile); err != nil {
+			log.Printf("Cannot write report file: %s, err: [%v]", *reportFile, err)
 		}
-		select {
-		case <-durationTimer.C:
-			fmt.Println("done")
-			return
-		case <-secondTimer.C:
-			log.Println("-1s")
-			continue
+	}
+	if *historyFile != "" {
+		if err := saveReports(*historyFile, report); err != nil {
+			log.Printf("Cannot save history: %s, err: [%v]", *historyFile, err)
 		}
 	}
+	if slowRequests != nil {
+		log.Printf("%d slow requests written to %s", slowRequests.count, *slowFile)
+	}
 }
 
 // -q 100 => avg=18.43444s, min=0.00571s, max=125.02240s, failed=1294, successCount=3503, successRatio=58.38%, timeOut=3411, timeOutRatio=56.85%
@@ -206,13 +286,18 @@ func benchmarkTest() {
 // -q 150 -l 1000 -m 10 -c 2 => avg=1.69894s, min=0.05533s, max=8.85485s, failed=471, successCount=866, successRatio=57.73%, timeOut=925, timeOutRatio=61.67%
 // 2020/03/11 14:05:40 test_company.go:263: success: avg=2.58271s, min=0.32639s, max=8.85485s, timeOut=805, timeOutRatio=92.96%
 
-func makeQuery(client pb.AdvancedSearch, verticals []string, investors []string) {
+// ctx: 整个压测的 ctx，drain 超时或者 Ctrl-C 时被取消
+// intended: 计划发送时间，延时从这里开始算
+// phase: 所在的压测阶段
+// rng: 这个请求专用的随机数，见 slotRand
+func makeQuery(ctx context.Context, client pb.AdvancedSearch, w *workload, rng *rand.Rand, intended time.Time, phase string) {
 
 	cursor := base64.StdEncoding.EncodeToString([]byte(strconv.Itoa(0)))
 	// cursor := base64.StdEncoding.EncodeToString([]byte(strconv.Itoa(rand.Intn(1000))))
-	var conditions = getSearchConditions(verticals, investors)
-	var orderColumns = getOrderColumns()
-	var columnIds = getColumnIds()
+	var spec = w.searchSpec(searchTypes[*searchType])
+	var conditions = spec.conditions(rng, w.vocabularies)
+	var orderColumns = spec.orderColumns(rng)
+	var columnIds = spec.columnIds(rng)
 	var req = pb.SearchRequest{
 		SearchType: searchTypes[*searchType],
 		First: &wrappers.Int32Value{
@@ -225,190 +310,112 @@ func makeQuery(client pb.AdvancedSearch, verticals []string, investors []string)
 		OrderColumns: orderColumns,
 		ColumnIds:    columnIds,
 	}
-	start := time.Now()
-	result, err := client.Search(context.Background(), &req)
-	cost := time.Since(start)
+	// 像用户翻页一样，上一页返回后马上用返回的 cursor 请求下一页，
+	// 直到 -pages 页或者没有下一页
+	for page := 1; ; page++ {
+		result := sendQuery(ctx, client, &req, intended, phase, page)
+		if page >= *pageDepth || ctx.Err() != nil || len(result.GetNodes()) == 0 || !result.GetPageInfo().GetHasNextPage() {
+			return
+		}
+		req.After = &wrappers.StringValue{
+			Value: result.GetPageInfo().GetEndCursor(),
+		}
+		intended = time.Now()
+	}
+}
+
+// sendQuery 发送请求并把结果交给 calculate，慢请求写入 -slow 文件
+// 出错时返回 nil
+func sendQuery(ctx context.Context, client pb.AdvancedSearch, req *pb.SearchRequest, intended time.Time, phase string, page int) *pb.SearchResponse {
+	if *requestDeadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *requestDeadline)
+		defer cancel()
+	}
+	series.markSent()
+	atomic.AddInt64(&counters.sent, 1)
+	result, err := client.Search(ctx, req)
+	cost := time.Since(intended)
+	counters.done(ctx, err)
 	var count int
 	if err == nil {
 		count = len(result.Nodes)
 	}
-	resChan <- testResult{Err: err, Cost: cost, Count: count}
-	if cost.Seconds()*1000 > float64(*timeLimit) {
-		reqChan <- req
+	res := testResult{Err: err, Cost: cost, Count: count, Phase: phase, Page: page, Sort: sortKey(req)}
+	resChan <- res
+	if slowRequests != nil && cost.Seconds()*1000 > float64(*timeLimit) {
+		record, err := newRequestRecord(req, intended, res)
+		if err == nil {
+			err = slowRequests.write(record)
+		}
+		if err != nil {
+			log.Printf("Cannot write slow request, err: [%v]", err)
+		}
 	}
+	return result
 }
 
-func calculate() {
-	var failed, timeOut, successCount int
-	var minCost, maxCost, avgCost, totalCost, timeOutRatio, successRatio float64
-	var successTimeOut int
-	var successMinCost, successMaxCost, successAvgCost, successTotalCost, successTimeOutRatio float64
-	minCost = 10000000
-	successMinCost = 10000000
-	for i := 0; i < reqCount; i++ {
-		res := <-resChan
-		if res.Err != nil {
-			failed++
-			continue
-		}
-		seconds := res.Cost.Seconds()
-		if res.Count != 0 {
-			successTotalCost += seconds
-			if seconds < successMinCost {
-				successMinCost = seconds
-			}
-			if seconds > successMaxCost {
-				successMaxCost = seconds
-			}
-			if seconds*1000 > float64(*timeLimit) {
-				successTimeOut++
-			}
-			successCount++
-		}
-		totalCost += seconds
-		if seconds < minCost {
-			minCost = seconds
-		}
-		if seconds > maxCost {
-			maxCost = seconds
-		}
-		if seconds*1000 > float64(*timeLimit) {
-			timeOut++
+// sortKey 按全部排序列和方向统计延时，比如 founded_at:desc,latest_deal_date:asc，
+// ES 的开销由排序列和方向一起决定
+func sortKey(req *pb.SearchRequest) string {
+	if len(req.OrderColumns) == 0 {
+		return noSort
+	}
+	keys := make([]string, 0)
+	for _, column := range req.OrderColumns {
+		direction := "asc"
+		if column.IsDesc {
+			direction = "desc"
 		}
+		keys = append(keys, column.ColumnId+":"+direction)
 	}
-	avgCost = totalCost / float64(reqCount)
-	timeOutRatio = float64(timeOut) / float64(reqCount) * 100
-	successRatio = float64(successCount) / float64(reqCount) * 100
-
-	successAvgCost = successTotalCost / float64(successCount)
-	successTimeOutRatio = float64(successTimeOut) / float64(successCount) * 100
-	log.Printf("avg=%.5fs, min=%.5fs, max=%.5fs, failed=%d, successCount=%d, successRatio=%.2f%%, timeOut=%d, timeOutRatio=%.2f%%\n",
-		avgCost, minCost, maxCost, failed, successCount, successRatio, timeOut, timeOutRatio)
-
-	log.Printf("success: avg=%.5fs, min=%.5fs, max=%.5fs, timeOut=%d, timeOutRatio=%.2f%%",
-		successAvgCost, successMinCost, successMaxCost, successTimeOut, successTimeOutRatio)
+	return strings.Join(keys, ",")
 }
 
-func printTimeOutReq() {
-	for i := 0; i < len(reqChan); i++ {
-		<-reqChan
-		// req := <-reqChan
-		// reqJSON, err := json.Marshal(req)
-		// if err != nil {
-		// 	fmt.Println(err)
-		// 	return
-		// }
-		// fmt.Println(string(reqJSON))
+// calculate 统计 resChan 中的结果，直到 resChan 被关闭
+func calculate() *runStats {
+	stats := &runStats{
+		all:     newCostStats(),
+		byPhase: make(map[string]*costStats),
+		byPage:  make(map[int]*costStats),
+		bySort:  make(map[string]*costStats),
+	}
+	for res := range resChan {
+		stats.add(res)
+		series.add(res)
 	}
+	return stats
 }
 
 // -p 50 -q 50 => avg=0.19381s, min=0.02836s, max=2.40481s, failed=0
 //             => avg=0.14639s, min=0.02872s, max=0.40912s, failed=0
-func getSearchConditions(verticals []string, investors []string) []*pb.SearchCondition {
-	searchConditions := make([]*pb.SearchCondition, 0)
-	searchConditions = append(searchConditions, randSearchCondition("company.founded_at", DateValueType))
-	searchConditions = append(searchConditions, randSearchCondition("company.latest_deal_date", DateValueType))
-	searchConditions = append(searchConditions, randSearchCondition("company.latest_deal_amount", AmountValueType))
-	searchConditions = append(searchConditions, randSearchCondition("company.post_money_valuation", AmountValueType))
-	searchConditions = append(searchConditions, randSearchCondition("company.total_deal_amount", AmountValueType))
-	searchConditions = append(searchConditions, randSearchCondition("company.deal_count", NumberValueType))
-	searchConditions = append(searchConditions, randSearchCondition("company.investment_count", NumberValueType))
-	searchConditions = append(searchConditions, randSearchCondition("company.investment_count_last_year", NumberValueType))
-	searchConditions = append(searchConditions, randSearchCondition("company.investment_amount_last_year", AmountValueType))
-	searchConditions = append(searchConditions, randSearchCondition("company.acquisition_count", NumberValueType))
-	searchConditions = append(searchConditions, randSearchCondition("company.acquisition_amount", AmountValueType))
-
-	searchConditions = append(searchConditions, searchCondition("company.ownership_status", pb.Operator_INCLUDES_ANY, randOwnershipStatus(nilPercent), ""))
-	searchConditions = append(searchConditions, searchCondition("company.financing_status", pb.Operator_INCLUDES_ANY, randFinancingStatus(nilPercent), ""))
-	searchConditions = append(searchConditions, searchCondition("company.headquarter_location", pb.Operator_INCLUDES_ANY, randHeadquarterLocation(nilPercent), ""))
-	searchConditions = append(searchConditions, searchCondition("company.latest_deal_type", pb.Operator_INCLUDES_ANY, randDealType(nilPercent), ""))
-
-	searchConditions = append(searchConditions, searchCondition("company.vertical", pb.Operator_INCLUDES_ANY, randChoice(nilPercent, verticals, 10), ""))
-	searchConditions = append(searchConditions, searchCondition("company.shareholder", pb.Operator_INCLUDES_ANY, randChoice(nilPercent, investors, 10), ""))
-	searchConditions = append(searchConditions, searchCondition("company.lead_investor", pb.Operator_INCLUDES_ANY, randChoice(nilPercent, investors, 10), ""))
-
-	result := make([]*pb.SearchCondition, 0)
-	for _, searchCondition := range searchConditions {
-		if searchCondition != nil {
-			result = append(result, searchCondition)
-		}
-	}
-	return choiceConditions(result, *conditionCount)
-}
-
-func choiceConditions(array []*pb.SearchCondition, count int) []*pb.SearchCondition {
+func choiceConditions(rng *rand.Rand, array []*pb.SearchCondition, count int) []*pb.SearchCondition {
 
 	choicedArr := make([]*pb.SearchCondition, 0)
 	if count <= 0 || array == nil {
 		return choicedArr
 	}
-	list := perm(len(array), count)
+	list := newUniformSampler(len(array)).sample(rng, count)
 	for _, index := range list {
 		choicedArr = append(choicedArr, array[index])
 	}
 	return choicedArr
 }
 
-func randDealType(nilPercent int) []string {
-	types := make([]string, 0)
-	for _, dealType := range dealTypes {
-		types = append(types, strconv.Itoa(int(dealType)))
-	}
-	return randChoice(nilPercent, types, 0)
-}
-
-func randHeadquarterLocation(nilPercent int) []string {
-	headquarterLocations := make([]string, 0)
-	for _, location := range locations {
-		headquarterLocations = append(headquarterLocations, strconv.Itoa(int(location)))
-	}
-	return randChoice(nilPercent, headquarterLocations, 0)
-}
-
-func randFinancingStatus(nilPercent int) []string {
-	status := make([]string, 0)
-	for _, financialStatus := range financialStatuses {
-		status = append(status, string(financialStatus))
-	}
-	return randChoice(nilPercent, status, 0)
-}
-
-func randOwnershipStatus(nilPercent int) []string {
-	status := make([]string, 0)
-	for _, ownershipStatus := range ownershipStatuses {
-		status = append(status, string(ownershipStatus))
-	}
-	return randChoice(nilPercent, status, 0)
-}
-
-func getInvestors(lines []string) []string {
+// firstColumns 取 csv 每行的第一列，跳过只有一列的行
+func firstColumns(lines []string) []string {
 	if lines == nil || len(lines) <= 0 {
 		return nil
 	}
-	investors := make([]string, 0)
+	values := make([]string, 0)
 	for _, line := range lines {
 		arr := strings.Split(line, ",")
 		if len(arr) <= 1 {
 			continue
 		}
-		investors = append(investors, strings.TrimSpace(arr[0]))
+		values = append(values, strings.TrimSpace(arr[0]))
 	}
-	return investors
-}
-
-func getVerticals(lines []string) []string {
-	if lines == nil || len(lines) <= 0 {
-		return nil
-	}
-	verticals := make([]string, 0)
-	for _, line := range lines {
-		arr := strings.Split(line, ",")
-		if len(arr) <= 1 {
-			continue
-		}
-		verticals = append(verticals, strings.TrimSpace(arr[0]))
-	}
-	return verticals
+	return values
 }
 
 func readFileLines(fileName string, count int64) ([]string, error) {
@@ -444,117 +451,95 @@ func readFileLines(fileName string, count int64) ([]string, error) {
 }
 
 // nilPercent: 返回 nil 的几率
+// s: 取样方式，为 nil 时均匀取样
 // maxLen: 返回最大长度,如果传0则最大长度为数组长度
-func randChoice(nilPercent int, array []string, maxLen int) []string {
-	if array == nil || !randBoolean(nilPercent) {
+func randChoice(rng *rand.Rand, nilPercent int, array []string, s sampler, maxLen int) []string {
+	if len(array) == 0 || !randBoolean(rng, nilPercent) {
 		return nil
 	}
 	if maxLen <= 0 {
 		maxLen = len(array)
 	}
-	count := rand.Intn(maxLen) + 1
-	return choice(array, count)
+	count := rng.Intn(maxLen) + 1
+	return choice(rng, array, s, count)
 }
 
-func choice(array []string, count int) []string {
+// choice 按 s 从 array 里取 count 个不重复的值，s 为 nil 时均匀取样
+func choice(rng *rand.Rand, array []string, s sampler, count int) []string {
 
 	choicedArr := make([]string, 0)
 	if count <= 0 || array == nil {
 		return choicedArr
 	}
-	list := perm(len(array), count)
+	if s == nil {
+		s = newUniformSampler(len(array))
+	}
+	list := s.sample(rng, count)
 	for _, index := range list {
 		choicedArr = append(choicedArr, array[index])
 	}
 	return choicedArr
 }
 
-// n: 数组总个数
-// count: 需要生成的随机数个数
-func perm(n int, count int) []int {
-	var list []int
-	var index = 0
-	if n > 200 {
-		// n > 200 时，Perm生成200以内随机，最终结果为 perm+随机index
-		list = rand.Perm(200)
-		index = rand.Intn(n - 200)
-	} else {
-		list = rand.Perm(n)
-	}
-	result := make([]int, 0)
-	for i, m := range list {
-		if i >= count {
-			break
-		}
-		result = append(result, m+index)
-	}
-	return result
-}
-
-func randSearchCondition(columnID string, columnValueType ValueType) *pb.SearchCondition {
-	if !randBoolean(nilPercent) {
-		return nil
-	}
-	var operator = randOperator(columnValueType)
-	switch columnValueType {
-	case NumberValueType:
-		return searchCondition(columnID, operator, randNumber(operator), "")
-	case AmountValueType:
-		return searchCondition(columnID, operator, randAmout(operator), currencyCodes[rand.Intn(currencyCodesLen)].Display())
-	case DateValueType:
-		return searchCondition(columnID, operator, randDate(operator), "")
-	// case TextValueType:
-	// case TextArrayValueType:
-	// case NumberArrayValueType:
-
-	default:
-		return &pb.SearchCondition{}
-	}
-}
-
-func randAmout(operator pb.Operator) []string {
-	randAmout := rand.Intn(10000)*200000 + 1
-	randAmoutStr := strconv.Itoa(randAmout)
-	if operator != pb.Operator_BETWEEN {
+func randAmout(rng *rand.Rand, operator pb.Operator, max int, scale int) []string {
+	n := rng.Intn(max)
+	randAmoutStr := strconv.Itoa(n*scale + 1)
+	if operatorArities[operator] != rangeValue {
 		return []string{randAmoutStr}
 	}
-	return []string{strconv.Itoa((randAmout - rand.Intn(randAmout)) / 2), randAmoutStr}
+	// 下限和上限一样按 scale 取整，在 [1, 上限] 里
+	return []string{strconv.Itoa(rng.Intn(n+1)*scale + 1), randAmoutStr}
 }
 
-func randNumber(operator pb.Operator) []string {
-	randInt := rand.Intn(10) + 1
+func randNumber(rng *rand.Rand, operator pb.Operator, min int, max int) []string {
+	randInt := rng.Intn(max-min+1) + min
 	randIntStr := strconv.Itoa(randInt)
-	if operator != pb.Operator_BETWEEN {
+	if operatorArities[operator] != rangeValue {
 		return []string{randIntStr}
 	}
-	return []string{strconv.Itoa((randInt - rand.Intn(randInt)) / 2), randIntStr}
+	// 下限在 [min, randInt] 里
+	return []string{strconv.Itoa(rng.Intn(randInt-min+1) + min), randIntStr}
 }
 
-func randDate(operator pb.Operator) []string {
-	randDate := *randomDate(zeroTime)
-	if operator != pb.Operator_BETWEEN {
+// from, to: 年份范围
+func randDate(rng *rand.Rand, operator pb.Operator, from int, to int) []string {
+	randDate := *randomDate(rng, zeroTime, from, to)
+	if operatorArities[operator] != rangeValue {
 		return []string{randDate.Format(dateFormat)}
 	}
-	return []string{randDate.Format(dateFormat), (*randomDate(randDate)).Format(dateFormat)}
+	return []string{randDate.Format(dateFormat), (*randomDate(rng, randDate, from, to)).Format(dateFormat)}
+}
+
+// randNumbers 在 [min, max] 中随机取最多 maxLen 个不重复的数，maxLen 为 0 时不限
+func randNumbers(rng *rand.Rand, min int, max int, maxLen int) []string {
+	if maxLen <= 0 || maxLen > max-min+1 {
+		maxLen = max - min + 1
+	}
+	count := rng.Intn(maxLen) + 1
+	numbers := make([]string, 0)
+	for _, n := range rng.Perm(max - min + 1)[:count] {
+		numbers = append(numbers, strconv.Itoa(n+min))
+	}
+	return numbers
 }
 
-func randomDate(base time.Time) *time.Time {
+func randomDate(rng *rand.Rand, base time.Time, from int, to int) *time.Time {
 	var randTime time.Time
 	if base.IsZero() {
 		randTime = time.Date(
-			rand.Intn(40)+1980,
-			time.Month(rand.Intn(12)+1),
-			rand.Intn(28)+1,
+			rng.Intn(to-from+1)+from,
+			time.Month(rng.Intn(12)+1),
+			rng.Intn(28)+1,
 			0, 0, 0, 0, time.UTC,
 		)
 	} else {
-		randTime = base.AddDate(rand.Intn(5), rand.Intn(5), rand.Intn(5))
+		randTime = base.AddDate(rng.Intn(5), rng.Intn(5), rng.Intn(5))
 	}
 	return &randTime
 }
 
-func randBoolean(falsePercent int) bool {
-	if rand.Intn(100) < falsePercent {
+func randBoolean(rng *rand.Rand, falsePercent int) bool {
+	if rng.Intn(100) < falsePercent {
 		return false
 	}
 	return true
@@ -572,40 +557,13 @@ func searchCondition(id string, operator pb.Operator, values []string, currencyC
 	}
 }
 
-func randOperator(valueType ValueType) pb.Operator {
-	switch valueType {
-	case NumberValueType:
-		return compareOP[rand.Intn(compareOPLen)]
-	case AmountValueType:
-		return compareOP[rand.Intn(compareOPLen)]
-	case DateValueType:
-		return compareOP[rand.Intn(compareOPLen)]
-	// case TextValueType:
-	// 	return pb.Operator_INCLUDES_ANY
-	// case TextArrayValueType:
-	// 	return pb.Operator_INCLUDES_ANY
-	// case NumberArrayValueType:
-	// 	return pb.Operator_INCLUDES_ANY
-	default:
+// randOperator 从 value type 可以用的 operator 里随机取一个
+func randOperator(rng *rand.Rand, valueType ValueType) pb.Operator {
+	operators := operatorsByValueType[valueType]
+	if len(operators) == 0 {
 		return pb.Operator_INCLUDES_ANY
 	}
-}
-
-func getOrderColumns() []*pb.OrderColumn {
-	return []*pb.OrderColumn{
-		&pb.OrderColumn{
-			ColumnId: "company_search_result.column.founded_at",
-			IsDesc:   true,
-		},
-	}
-}
-
-func getColumnIds() []string {
-	return []string{
-		"company_search_result.column.short_name",
-		"company_search_result.column.full_name",
-		"company_search_result.column.founded_at",
-	}
+	return operators[rng.Intn(len(operators))]
 }
 
 type ValueType int
@@ -614,21 +572,14 @@ const (
 	NumberValueType ValueType = iota
 	AmountValueType
 	DateValueType
-	// TextValueType
-	// TextArrayValueType
-	// NumberArrayValueType
+	TextValueType
+	TextArrayValueType
+	NumberArrayValueType
 )
 
-var compareOP = []pb.Operator{
-	pb.Operator_AFTER,
-	pb.Operator_BEFORE,
-	pb.Operator_BETWEEN,
-}
-var compareOPLen = len(compareOP)
-
 const (
 	dateFormat = "2006-01-02"
-	nilPercent = 0
+	noSort     = "none"
 )
 
 var zeroTime time.Time
@@ -727,6 +678,4 @@ var currencyCodes = []essentials.CurrencyCode{
 }
 var currencyCodesLen = len(currencyCodes)
 
-var investorsFileName = "../mock_data/investors.csv"
-var verticalsFileName = "../mock_data/verticals.csv"
-var industriesFileName = "../mock_data/industries.csv"
+var searchURL = "http://localhost:8081"
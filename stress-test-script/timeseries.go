@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+var seriesFile = flag.String("series", "", "write per-interval stats to this file, .csv or .jsonl")
+var seriesInterval = flag.Duration("interval", time.Second, "interval of per-interval stats")
+
+// series 为 nil 时不记录
+var series *seriesRecorder
+
+// seriesRow 一个统计周期的数据，延时单位秒
+type seriesRow struct {
+	Time      time.Time `json:"time"`
+	Elapsed   float64   `json:"elapsed"`
+	Sent      int       `json:"sent"`
+	Completed int       `json:"completed"`
+	Errors    int       `json:"errors"`
+	Empty     int       `json:"empty"`
+	P50       float64   `json:"p50"`
+	P99       float64   `json:"p99"`
+	InFlight  int64     `json:"inFlight"`
+}
+
+var seriesHeader = []string{"time", "elapsed", "sent", "completed", "errors", "empty", "p50", "p99", "inFlight"}
+
+func (row seriesRow) strings() []string {
+	return []string{
+		row.Time.Format(time.RFC3339),
+		strconv.FormatFloat(row.Elapsed, 'f', 0, 64),
+		strconv.Itoa(row.Sent),
+		strconv.Itoa(row.Completed),
+		strconv.Itoa(row.Errors),
+		strconv.Itoa(row.Empty),
+		strconv.FormatFloat(row.P50, 'f', 5, 64),
+		strconv.FormatFloat(row.P99, 'f', 5, 64),
+		strconv.FormatInt(row.InFlight, 10),
+	}
+}
+
+// seriesRecorder 按周期汇总请求，每个周期输出一行
+// 没有指定文件时输出到日志
+type seriesRecorder struct {
+	mu    sync.Mutex
+	start time.Time
+
+	sent, completed, errors, empty int
+	totalSent, totalCompleted      int64
+	costs                          *hdrhistogram.Histogram
+
+	file       *os.File
+	csvWriter  *csv.Writer
+	jsonWriter *json.Encoder
+	stop       chan struct{}
+	stopped    chan struct{}
+}
+
+func newSeriesRecorder(fileName string) (*seriesRecorder, error) {
+	r := &seriesRecorder{
+		start:   time.Now(),
+		costs:   newCostHistogram(),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	if fileName == "" {
+		return r, nil
+	}
+	file, err := os.Create(fileName)
+	if err != nil {
+		return nil, err
+	}
+	r.file = file
+	if strings.HasSuffix(fileName, ".csv") {
+		r.csvWriter = csv.NewWriter(file)
+		r.csvWriter.Write(seriesHeader)
+	} else {
+		r.jsonWriter = json.NewEncoder(file)
+	}
+	return r, nil
+}
+
+func (r *seriesRecorder) markSent() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.sent++
+	r.totalSent++
+	r.mu.Unlock()
+}
+
+func (r *seriesRecorder) add(res testResult) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.completed++
+	r.totalCompleted++
+	if res.Err != nil {
+		r.errors++
+		return
+	}
+	if res.Count == 0 {
+		r.empty++
+	}
+	recordCost(r.costs, res.Cost)
+}
+
+// run 每个周期输出一行，直到 close 被调用
+func (r *seriesRecorder) run(interval time.Duration) {
+	defer close(r.stopped)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			r.flush(now)
+		case <-r.stop:
+			r.flush(time.Now())
+			return
+		}
+	}
+}
+
+func (r *seriesRecorder) flush(now time.Time) {
+	r.mu.Lock()
+	row := seriesRow{
+		Time:      now,
+		Elapsed:   now.Sub(r.start).Round(time.Second).Seconds(),
+		Sent:      r.sent,
+		Completed: r.completed,
+		Errors:    r.errors,
+		Empty:     r.empty,
+		P50:       costSeconds(r.costs.ValueAtQuantile(50)),
+		P99:       costSeconds(r.costs.ValueAtQuantile(99)),
+		InFlight:  r.totalSent - r.totalCompleted,
+	}
+	r.sent, r.completed, r.errors, r.empty = 0, 0, 0, 0
+	r.costs.Reset()
+	r.mu.Unlock()
+
+	switch {
+	case r.csvWriter != nil:
+		r.csvWriter.Write(row.strings())
+		r.csvWriter.Flush()
+	case r.jsonWriter != nil:
+		r.jsonWriter.Encode(row)
+	default:
+		log.Printf("sent=%d, completed=%d, errors=%d, empty=%d, p50=%.5fs, p99=%.5fs, inFlight=%d",
+			row.Sent, row.Completed, row.Errors, row.Empty, row.P50, row.P99, row.InFlight)
+	}
+}
+
+func (r *seriesRecorder) close() {
+	if r == nil {
+		return
+	}
+	close(r.stop)
+	<-r.stopped
+	if r.file != nil {
+		r.file.Close()
+	}
+}
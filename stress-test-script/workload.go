@@ -0,0 +1,554 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+
+	pb "gitlab.com/momentum-valley/advanced-search/rpc/advanced-search"
+	"gopkg.in/yaml.v2"
+)
+
+var workloadFile = flag.String("w", "workload.yaml", "workload file(yaml or json) describing the conditions of each search type")
+
+// workload 描述每种搜索的请求怎么生成，改字段或者加搜索类型只需要改 workload 文件
+type workload struct {
+	// Vocabularies 词表名 -> 来源，条件的 choice 生成器从词表里取值
+	Vocabularies map[string]*vocabularySource `yaml:"vocabularies"`
+	// SearchTypes key 是 pb.SearchType 的名字，比如 COMPANY
+	SearchTypes map[string]*searchSpec `yaml:"search_types"`
+
+	// 启动时加载的词表
+	vocabularies map[string]*vocabulary
+}
+
+// vocabularySource 词表来源，files、values 和 enum 的值会合并
+type vocabularySource struct {
+	// Files csv 文件，取每行的第一列
+	Files []string `yaml:"files"`
+	// Sample 启动时从文件里随机取 sample 个（保持文件里的顺序），0 表示全部
+	Sample int      `yaml:"sample"`
+	Values []string `yaml:"values"`
+	// Enum 内置的枚举：deal_type, location, financial_status, ownership_status
+	Enum string `yaml:"enum"`
+	// Sampling 生成条件时怎么取值：uniform（默认）, weighted, zipf，见 sampling.go
+	Sampling string `yaml:"sampling"`
+	// WeightColumn weighted 用的 csv 频次列，从 0 开始，第 0 列是值；
+	// 频次不是数字的行（比如表头）会被跳过，values 和 enum 的权重为 1
+	WeightColumn int `yaml:"weight_column"`
+	// Exponent zipf 的指数，不填为 1，按合并后的顺序排名
+	Exponent float64 `yaml:"exponent"`
+}
+
+// vocabulary 加载好的词表
+type vocabulary struct {
+	values  []string
+	sampler sampler
+}
+
+// randChoice 按词表的取样方式取 1 到 maxLen 个值，词表不存在时返回 nil
+func (v *vocabulary) randChoice(rng *rand.Rand, maxLen int) []string {
+	if v == nil {
+		return nil
+	}
+	return randChoice(rng, 0, v.values, v.sampler, maxLen)
+}
+
+type searchSpec struct {
+	Conditions []*columnSpec `yaml:"conditions"`
+	// Count 每个请求最多带几个条件，0 表示用 -c
+	Count int `yaml:"count"`
+	// Columns 可以返回的结果列
+	Columns []string `yaml:"columns"`
+	// Projection 每个请求随机返回几列，不填时返回所有 columns
+	Projection countRange `yaml:"projection"`
+	// SortColumns 可以排序的列
+	SortColumns []string `yaml:"sort_columns"`
+	// Sorts 每个请求随机按几列排序，不填为 1
+	Sorts countRange `yaml:"sorts"`
+	// DescProbability 每个排序列倒序的概率，不填为 0.5
+	DescProbability *float64 `yaml:"desc_probability"`
+}
+
+// countRange 个数的范围 [min, max]，max 为 0 表示没有配置
+type countRange struct {
+	Min int `yaml:"min"`
+	Max int `yaml:"max"`
+}
+
+// columnSpec 一个条件字段
+type columnSpec struct {
+	ID string `yaml:"id"`
+	// ValueType number, amount, date, text, text_array, number_array，
+	// 为空时需要指定 operators 和 generator
+	ValueType string `yaml:"value_type"`
+	// Operators pb.Operator 的名字，为空时从 value type 可以用的 operator 里选
+	Operators []string `yaml:"operators"`
+	// OperatorWeights operator 名字 -> 权重，和 operators 二选一
+	OperatorWeights map[string]int `yaml:"operator_weights"`
+	// Generator 值的生成器，为空时按 value type 选，见 valueGenerators
+	Generator string          `yaml:"generator"`
+	Params    generatorParams `yaml:"params"`
+	// Probability 条件出现在候选里的概率，不填为 1
+	Probability *float64 `yaml:"probability"`
+
+	valueType ValueType
+	operators []pb.Operator
+	weights   []int
+	generator valueGenerator
+}
+
+type generatorParams struct {
+	// Min, Max number 和 numbers 的取值范围，amount 的倍数
+	Min int `yaml:"min"`
+	Max int `yaml:"max"`
+	// Scale amount 的单位
+	Scale int `yaml:"scale"`
+	// From, To date 的年份范围
+	From int `yaml:"from"`
+	To   int `yaml:"to"`
+	// Vocabulary text 和 choice 取值的词表
+	Vocabulary string `yaml:"vocabulary"`
+	// MaxValues choice 和 numbers 最多取几个值，0 表示不限
+	MaxValues int `yaml:"max_values"`
+}
+
+// setDefaults 没填的参数用原来写死的范围
+func (p *generatorParams) setDefaults(generator string) {
+	switch generator {
+	case "number", "numbers":
+		if p.Max == 0 {
+			p.Min, p.Max = 1, 10
+		}
+	case "amount":
+		if p.Max == 0 {
+			p.Max = 10000
+		}
+		if p.Scale == 0 {
+			p.Scale = 200000
+		}
+	case "date":
+		if p.From == 0 {
+			p.From = 1980
+		}
+		if p.To == 0 {
+			p.To = 2019
+		}
+	}
+}
+
+// check 检查参数的范围，不合法的范围会让 rand.Intn panic
+func (p *generatorParams) check(generator string) error {
+	switch generator {
+	case "number", "numbers":
+		if p.Min > p.Max {
+			return fmt.Errorf("min %d is greater than max %d", p.Min, p.Max)
+		}
+	case "amount":
+		if p.Max <= 0 || p.Scale <= 0 {
+			return fmt.Errorf("max and scale should be positive, got %d and %d", p.Max, p.Scale)
+		}
+	case "date":
+		if p.From < 1 || p.From > p.To {
+			return fmt.Errorf("from %d should be positive and not after to %d", p.From, p.To)
+		}
+	case "choice", "text":
+		if p.Vocabulary == "" {
+			return fmt.Errorf("%s generator needs a vocabulary", generator)
+		}
+	}
+	return nil
+}
+
+// valueGenerator 按 operator 生成条件的值，返回 nil 表示不带这个条件
+type valueGenerator func(rng *rand.Rand, c *columnSpec, operator pb.Operator, vocabularies map[string]*vocabulary) []string
+
+var valueGenerators = map[string]valueGenerator{
+	"number": func(rng *rand.Rand, c *columnSpec, operator pb.Operator, vocabularies map[string]*vocabulary) []string {
+		return randNumber(rng, operator, c.Params.Min, c.Params.Max)
+	},
+	"amount": func(rng *rand.Rand, c *columnSpec, operator pb.Operator, vocabularies map[string]*vocabulary) []string {
+		return randAmout(rng, operator, c.Params.Max, c.Params.Scale)
+	},
+	"date": func(rng *rand.Rand, c *columnSpec, operator pb.Operator, vocabularies map[string]*vocabulary) []string {
+		return randDate(rng, operator, c.Params.From, c.Params.To)
+	},
+	"choice": func(rng *rand.Rand, c *columnSpec, operator pb.Operator, vocabularies map[string]*vocabulary) []string {
+		return vocabularies[c.Params.Vocabulary].randChoice(rng, c.Params.MaxValues)
+	},
+	// text 从词表里取一个值
+	"text": func(rng *rand.Rand, c *columnSpec, operator pb.Operator, vocabularies map[string]*vocabulary) []string {
+		return vocabularies[c.Params.Vocabulary].randChoice(rng, 1)
+	},
+	"numbers": func(rng *rand.Rand, c *columnSpec, operator pb.Operator, vocabularies map[string]*vocabulary) []string {
+		return randNumbers(rng, c.Params.Min, c.Params.Max, c.Params.MaxValues)
+	},
+}
+
+var valueTypeNames = map[string]ValueType{
+	"number":       NumberValueType,
+	"amount":       AmountValueType,
+	"date":         DateValueType,
+	"text":         TextValueType,
+	"text_array":   TextArrayValueType,
+	"number_array": NumberArrayValueType,
+}
+
+// noValueType 没有 value type 的条件，比如枚举和词表
+const noValueType ValueType = -1
+
+// 每种 value type 默认的生成器
+var defaultGenerators = map[ValueType]string{
+	NumberValueType:      "number",
+	AmountValueType:      "amount",
+	DateValueType:        "date",
+	TextValueType:        "text",
+	TextArrayValueType:   "choice",
+	NumberArrayValueType: "numbers",
+}
+
+func loadWorkload(fileName string) (*workload, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	w := &workload{}
+	// json 也是合法的 yaml
+	if err := yaml.UnmarshalStrict(data, w); err != nil {
+		return nil, err
+	}
+	for name, source := range w.Vocabularies {
+		if source.Sampling == weightedSampling && source.WeightColumn <= 0 {
+			return nil, fmt.Errorf("vocabulary %s: weighted sampling needs a weight_column", name)
+		}
+	}
+	for name, spec := range w.SearchTypes {
+		if _, ok := pb.SearchType_value[name]; !ok {
+			return nil, fmt.Errorf("unknown search type %q", name)
+		}
+		if len(spec.Columns) == 0 {
+			return nil, fmt.Errorf("%s has no columns", name)
+		}
+		if err := spec.Projection.check(); err != nil {
+			return nil, fmt.Errorf("%s projection: %v", name, err)
+		}
+		if err := spec.Sorts.check(); err != nil {
+			return nil, fmt.Errorf("%s sorts: %v", name, err)
+		}
+		if p := spec.DescProbability; p != nil && (*p < 0 || *p > 1) {
+			return nil, fmt.Errorf("%s desc_probability should be in [0, 1], got %g", name, *p)
+		}
+		for i, c := range spec.Conditions {
+			if err := c.init(); err != nil {
+				return nil, fmt.Errorf("%s condition %d: %v", name, i+1, err)
+			}
+			if c.Params.Vocabulary != "" && w.Vocabularies[c.Params.Vocabulary] == nil {
+				return nil, fmt.Errorf("%s condition %s: unknown vocabulary %q", name, c.ID, c.Params.Vocabulary)
+			}
+		}
+	}
+	return w, nil
+}
+
+func (c *columnSpec) init() error {
+	if c.ID == "" {
+		return fmt.Errorf("missing id")
+	}
+	c.valueType = noValueType
+	if c.ValueType != "" {
+		valueType, ok := valueTypeNames[c.ValueType]
+		if !ok {
+			return fmt.Errorf("unknown value type %q", c.ValueType)
+		}
+		c.valueType = valueType
+	} else if (len(c.Operators) == 0 && len(c.OperatorWeights) == 0) || c.Generator == "" {
+		return fmt.Errorf("operators and generator are required without value type")
+	}
+	if len(c.Operators) > 0 && len(c.OperatorWeights) > 0 {
+		return fmt.Errorf("use either operators or operator_weights")
+	}
+	names := c.Operators
+	if len(c.OperatorWeights) > 0 {
+		names = make([]string, 0)
+		for name := range c.OperatorWeights {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	for _, name := range names {
+		operator, err := c.operator(name)
+		if err != nil {
+			return err
+		}
+		weight := 1
+		if c.OperatorWeights != nil {
+			weight = c.OperatorWeights[name]
+		}
+		if weight <= 0 {
+			return fmt.Errorf("weight of %s should be positive, got %d", name, weight)
+		}
+		c.operators = append(c.operators, operator)
+		c.weights = append(c.weights, weight)
+	}
+	if c.Generator == "" {
+		c.Generator = defaultGenerators[c.valueType]
+	}
+	c.generator = valueGenerators[c.Generator]
+	if c.generator == nil {
+		return fmt.Errorf("unknown generator %q", c.Generator)
+	}
+	c.Params.setDefaults(c.Generator)
+	if err := c.Params.check(c.Generator); err != nil {
+		return err
+	}
+	if c.Probability != nil && (*c.Probability < 0 || *c.Probability > 1) {
+		return fmt.Errorf("probability should be in [0, 1], got %g", *c.Probability)
+	}
+	return nil
+}
+
+// operator 检查 operator 存在，并且能用于这个字段的 value type
+func (c *columnSpec) operator(name string) (pb.Operator, error) {
+	value, ok := pb.Operator_value[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown operator %q", name)
+	}
+	operator := pb.Operator(value)
+	// 不知道要几个值，不能用
+	if _, ok := operatorArities[operator]; !ok {
+		return 0, fmt.Errorf("operator %s is not in operatorSpecs", name)
+	}
+	if c.valueType == noValueType {
+		return operator, nil
+	}
+	for _, o := range operatorsByValueType[c.valueType] {
+		if o == operator {
+			return operator, nil
+		}
+	}
+	return 0, fmt.Errorf("operator %s does not fit value type %s", name, c.ValueType)
+}
+
+// loadSearchWorkload 加载 -w 和词表，检查 -t 的搜索类型有配置
+func loadSearchWorkload() (*workload, error) {
+	if unknown := unknownOperators(); len(unknown) > 0 {
+		log.Printf("operators %s are not in operatorSpecs, skip them", strings.Join(unknown, ", "))
+	}
+	w, err := loadWorkload(*workloadFile)
+	if err != nil {
+		log.Printf("Cannot load workload file: %s, err: [%v]", *workloadFile, err)
+		return nil, err
+	}
+	if w.searchSpec(searchTypes[*searchType]) == nil {
+		err = fmt.Errorf("search type %s is not in workload", searchTypes[*searchType])
+		log.Printf("Cannot load workload file: %s, err: [%v]", *workloadFile, err)
+		return nil, err
+	}
+	if err := w.loadVocabularies(); err != nil {
+		log.Printf("Cannot load vocabularies, err: [%v]", err)
+		return nil, err
+	}
+	return w, nil
+}
+
+// loadVocabularies 读取词表文件，只需要调用一次
+func (w *workload) loadVocabularies() error {
+	w.vocabularies = make(map[string]*vocabulary)
+	for name, source := range w.Vocabularies {
+		v, err := source.load(slotRand(vocabularyStream, nameSlot(name)))
+		if err != nil {
+			return fmt.Errorf("vocabulary %s: %v", name, err)
+		}
+		if len(v.values) == 0 {
+			log.Printf("vocabulary %s is empty", name)
+		}
+		w.vocabularies[name] = v
+	}
+	return nil
+}
+
+func (source *vocabularySource) load(rng *rand.Rand) (*vocabulary, error) {
+	values := make([]string, 0)
+	weights := make([]float64, 0)
+	for _, fileName := range source.Files {
+		lines, err := readFileLines(fileName, 0)
+		if err != nil {
+			return nil, err
+		}
+		if source.Sampling != weightedSampling {
+			values = append(values, firstColumns(lines)...)
+			continue
+		}
+		fileValues, fileWeights, skipped := weightedColumns(lines, source.WeightColumn)
+		if skipped > 0 {
+			log.Printf("%s: skipped %d lines without weight", fileName, skipped)
+		}
+		values = append(values, fileValues...)
+		weights = append(weights, fileWeights...)
+	}
+	if source.Sample > 0 && source.Sample < len(values) {
+		indexes := newUniformSampler(len(values)).sample(rng, source.Sample)
+		sort.Ints(indexes)
+		sampledValues := make([]string, 0)
+		sampledWeights := make([]float64, 0)
+		for _, i := range indexes {
+			sampledValues = append(sampledValues, values[i])
+			if len(weights) > 0 {
+				sampledWeights = append(sampledWeights, weights[i])
+			}
+		}
+		values, weights = sampledValues, sampledWeights
+	}
+	values = append(values, source.Values...)
+	if source.Enum != "" {
+		enum, ok := enumVocabularies[source.Enum]
+		if !ok {
+			return nil, fmt.Errorf("unknown enum %q", source.Enum)
+		}
+		values = append(values, enum()...)
+	}
+	for len(weights) < len(values) {
+		weights = append(weights, 1)
+	}
+	exponent := source.Exponent
+	if exponent == 0 {
+		exponent = 1
+	}
+	s, err := newSampler(source.Sampling, len(values), weights, exponent)
+	if err != nil {
+		return nil, err
+	}
+	return &vocabulary{values: values, sampler: s}, nil
+}
+
+// weightedColumns 取 csv 每行的第一列和第 weightColumn 列，跳过频次不是数字的行
+func weightedColumns(lines []string, weightColumn int) ([]string, []float64, int) {
+	values := make([]string, 0)
+	weights := make([]float64, 0)
+	skipped := 0
+	for _, line := range lines {
+		arr := strings.Split(line, ",")
+		if weightColumn >= len(arr) {
+			skipped++
+			continue
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(arr[weightColumn]), 64)
+		if err != nil || weight < 0 {
+			skipped++
+			continue
+		}
+		values = append(values, strings.TrimSpace(arr[0]))
+		weights = append(weights, weight)
+	}
+	return values, weights, skipped
+}
+
+// searchSpec 返回 searchType 的配置，没有配置时返回 nil
+func (w *workload) searchSpec(searchType pb.SearchType) *searchSpec {
+	return w.SearchTypes[pb.SearchType_name[int32(searchType)]]
+}
+
+// conditions 按概率生成所有候选条件，再随机取 count 个
+func (s *searchSpec) conditions(rng *rand.Rand, vocabularies map[string]*vocabulary) []*pb.SearchCondition {
+	result := make([]*pb.SearchCondition, 0)
+	for _, c := range s.Conditions {
+		if condition := c.randCondition(rng, vocabularies); condition != nil {
+			result = append(result, condition)
+		}
+	}
+	count := s.Count
+	if count <= 0 {
+		count = *conditionCount
+	}
+	return choiceConditions(rng, result, count)
+}
+
+// orderColumns 从 sort_columns 里随机取几列，随机正序倒序
+func (s *searchSpec) orderColumns(rng *rand.Rand) []*pb.OrderColumn {
+	descProbability := 0.5
+	if s.DescProbability != nil {
+		descProbability = *s.DescProbability
+	}
+	orderColumns := make([]*pb.OrderColumn, 0)
+	for _, column := range choice(rng, s.SortColumns, nil, s.Sorts.rand(rng, 1)) {
+		orderColumns = append(orderColumns, &pb.OrderColumn{
+			ColumnId: column,
+			IsDesc:   rng.Float64() < descProbability,
+		})
+	}
+	return orderColumns
+}
+
+// columnIds 从 columns 里随机取 projection 列
+func (s *searchSpec) columnIds(rng *rand.Rand) []string {
+	if s.Projection.Max == 0 {
+		return s.Columns
+	}
+	return choice(rng, s.Columns, nil, s.Projection.rand(rng, len(s.Columns)))
+}
+
+func (r countRange) check() error {
+	if r.Min < 0 || r.Min > r.Max {
+		return fmt.Errorf("bad range [%d, %d]", r.Min, r.Max)
+	}
+	return nil
+}
+
+// rand 在范围内随机取一个数，没有配置时返回 defaultCount
+func (r countRange) rand(rng *rand.Rand, defaultCount int) int {
+	if r.Max == 0 {
+		return defaultCount
+	}
+	return r.Min + rng.Intn(r.Max-r.Min+1)
+}
+
+func (c *columnSpec) randCondition(rng *rand.Rand, vocabularies map[string]*vocabulary) *pb.SearchCondition {
+	if c.Probability != nil && rng.Float64() >= *c.Probability {
+		return nil
+	}
+	operator := randOperator(rng, c.valueType)
+	if len(c.operators) > 0 {
+		operator = c.operators[randWeighted(rng, c.weights)]
+	}
+	var currencyCode string
+	if c.valueType == AmountValueType {
+		currencyCode = currencyCodes[rng.Intn(currencyCodesLen)].Display()
+	}
+	return searchCondition(c.ID, operator, fitArity(operator, c.generator(rng, c, operator, vocabularies)), currencyCode)
+}
+
+var enumVocabularies = map[string]func() []string{
+	"deal_type": func() []string {
+		types := make([]string, 0)
+		for _, dealType := range dealTypes {
+			types = append(types, strconv.Itoa(int(dealType)))
+		}
+		return types
+	},
+	"location": func() []string {
+		headquarterLocations := make([]string, 0)
+		for _, location := range locations {
+			headquarterLocations = append(headquarterLocations, strconv.Itoa(int(location)))
+		}
+		return headquarterLocations
+	},
+	"financial_status": func() []string {
+		status := make([]string, 0)
+		for _, financialStatus := range financialStatuses {
+			status = append(status, string(financialStatus))
+		}
+		return status
+	},
+	"ownership_status": func() []string {
+		status := make([]string, 0)
+		for _, ownershipStatus := range ownershipStatuses {
+			status = append(status, string(ownershipStatus))
+		}
+		return status
+	},
+}
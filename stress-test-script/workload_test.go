@@ -0,0 +1,106 @@
+package main
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+
+	pb "gitlab.com/momentum-valley/advanced-search/rpc/advanced-search"
+)
+
+func TestLoadWorkloadFile(t *testing.T) {
+	w, err := loadWorkload("workload.yaml")
+	if err != nil {
+		t.Fatalf("loadWorkload() error = %v", err)
+	}
+	if w.searchSpec(pb.SearchType_COMPANY) == nil {
+		t.Errorf("search type %s is not in workload.yaml", pb.SearchType_COMPANY)
+	}
+}
+
+func TestColumnSpecParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		wantErr bool
+	}{
+		{name: "number default", spec: "{id: a, value_type: number}"},
+		{name: "number one", spec: "{id: a, value_type: number, params: {min: 1, max: 1}}"},
+		{name: "number zero min", spec: "{id: a, value_type: number, params: {min: 0, max: 5}}"},
+		{name: "number negative min", spec: "{id: a, value_type: number, params: {min: -3, max: 5}}"},
+		{name: "number min above max", spec: "{id: a, value_type: number, params: {min: 6, max: 5}}", wantErr: true},
+		{name: "numbers zero min", spec: "{id: a, value_type: number_array, params: {min: 0, max: 5}}"},
+		{name: "numbers min above max", spec: "{id: a, value_type: number_array, params: {min: 6, max: 5}}", wantErr: true},
+		{name: "amount default", spec: "{id: a, value_type: amount}"},
+		{name: "amount negative max", spec: "{id: a, value_type: amount, params: {max: -1}}", wantErr: true},
+		{name: "amount negative scale", spec: "{id: a, value_type: amount, params: {scale: -1}}", wantErr: true},
+		{name: "date default", spec: "{id: a, value_type: date}"},
+		{name: "date one year", spec: "{id: a, value_type: date, params: {from: 2019}}"},
+		// to 默认是 2019
+		{name: "date from after default to", spec: "{id: a, value_type: date, params: {from: 2021}}", wantErr: true},
+		{name: "date from after to", spec: "{id: a, value_type: date, params: {from: 2010, to: 2000}}", wantErr: true},
+		{name: "text without vocabulary", spec: "{id: a, value_type: text}", wantErr: true},
+	}
+	rng := rand.New(rand.NewSource(1))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &columnSpec{}
+			if err := yaml.UnmarshalStrict([]byte(tt.spec), c); err != nil {
+				t.Fatal(err)
+			}
+			err := c.init()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			// 合法的参数用每个 operator 都不能 panic
+			for _, operator := range operatorsByValueType[c.valueType] {
+				for i := 0; i < 1000; i++ {
+					c.generator(rng, c, operator, nil)
+				}
+			}
+		})
+	}
+}
+
+// BETWEEN 的下限不能小于 min，也不能大于上限
+func TestRangeBounds(t *testing.T) {
+	tests := []struct {
+		name     string
+		generate func(rng *rand.Rand) []string
+		min      int
+	}{
+		{"number", func(rng *rand.Rand) []string { return randNumber(rng, pb.Operator_BETWEEN, 10, 20) }, 10},
+		{"number zero min", func(rng *rand.Rand) []string { return randNumber(rng, pb.Operator_BETWEEN, 0, 3) }, 0},
+		{"number negative min", func(rng *rand.Rand) []string { return randNumber(rng, pb.Operator_BETWEEN, -5, -1) }, -5},
+		{"amount", func(rng *rand.Rand) []string { return randAmout(rng, pb.Operator_BETWEEN, 10, 1000) }, 1},
+	}
+	rng := rand.New(rand.NewSource(1))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 1000; i++ {
+				values := tt.generate(rng)
+				lower, _ := strconv.Atoi(values[0])
+				upper, _ := strconv.Atoi(values[1])
+				if lower < tt.min || lower > upper {
+					t.Fatalf("range = %v, want lower in [%d, %d]", values, tt.min, upper)
+				}
+			}
+		})
+	}
+}
+
+func TestSortKey(t *testing.T) {
+	req := &pb.SearchRequest{}
+	if got := sortKey(req); got != noSort {
+		t.Errorf("sortKey() = %s, want %s", got, noSort)
+	}
+	req.OrderColumns = []*pb.OrderColumn{{ColumnId: "a", IsDesc: true}, {ColumnId: "b"}}
+	if got := sortKey(req); got != "a:desc,b:asc" {
+		t.Errorf("sortKey() = %s, want a:desc,b:asc", got)
+	}
+}